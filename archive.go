@@ -0,0 +1,134 @@
+package copycat
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// RunToTarGz renders the template tree in memory, without touching the output filesystem,
+// and streams the generated files and directories to w as a gzip compressed tar archive, rooted at the output root.
+func (cc *CopyCat) RunToTarGz(templatePath string, w io.Writer) error {
+	memFS, err := cc.runInMemory(templatePath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	return faults.Wrap(WriteTarGz(w, memFS, memRoot))
+}
+
+// WriteTarGz writes the tree under root to w as a gzip compressed tar archive, with entry names relative to root.
+// Directories get entries of their own, so that empty directories are kept, and the permissions are preserved.
+func WriteTarGz(w io.Writer, fsys afero.Fs, root string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	err := afero.Walk(fsys, root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		return writeTarEntry(tw, fsys, path, filepath.ToSlash(rel), info)
+	})
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	if err := tw.Close(); err != nil {
+		return faults.Wrap(err)
+	}
+	return faults.Wrap(gz.Close())
+}
+
+// writeTarEntry writes the header of a file or directory and, for files, streams its content
+func writeTarEntry(tw *tar.Writer, fsys afero.Fs, path, name string, info os.FileInfo) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		ModTime: info.ModTime(),
+	}
+	if info.IsDir() {
+		header.Typeflag = tar.TypeDir
+		header.Name += "/"
+	} else {
+		header.Typeflag = tar.TypeReg
+		header.Size = info.Size()
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return faults.Wrap(err)
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return faults.Wrap(err)
+}
+
+// LoadTarGz reads a gzip compressed tar archive, like a template pack distributed as a single artifact,
+// into a read-only in-memory filesystem that can be used as the template filesystem.
+// Directories missing from the archive are created for the files in them.
+func LoadTarGz(r io.Reader) (afero.Fs, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	defer gz.Close()
+
+	memFS := afero.NewMemMapFs()
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "/"))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return nil, faults.Wrap(&PathEscapeError{Name: header.Name, Path: name})
+		}
+		name = filepath.FromSlash(name)
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := memFS.MkdirAll(name, os.FileMode(header.Mode).Perm()|0o700); err != nil {
+				return nil, faults.Wrap(err)
+			}
+		case tar.TypeReg:
+			if err := memFS.MkdirAll(filepath.Dir(name), defaultDirMode); err != nil {
+				return nil, faults.Wrap(err)
+			}
+			f, err := memFS.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				_ = f.Close()
+				return nil, faults.Wrapf(err, "reading %s", header.Name)
+			}
+			if err := f.Close(); err != nil {
+				return nil, faults.Wrap(err)
+			}
+		}
+		// links and special files are not part of template packs
+	}
+	return afero.NewReadOnlyFs(memFS), nil
+}
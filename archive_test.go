@@ -0,0 +1,93 @@
+package copycat
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunToTarGz(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(afero.NewOsFs(), outFS, model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, cc.RunToTarGz("examples/template", &buf))
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	var names []string
+	files := map[string]string{}
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, header.Name)
+		if header.Typeflag == tar.TypeReg {
+			assert.Equal(t, int64(0o644), header.Mode, header.Name)
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			files[header.Name] = string(data)
+		}
+	}
+
+	assert.Equal(t, []string{
+		"my_app/",
+		"my_app/README.md",
+		"my_app/auth/",
+		"my_app/auth/auth.go",
+		"my_app/auth/config.txt",
+		"my_app/payments/",
+		"my_app/payments/config.txt",
+		"my_app/payments/payments.go",
+	}, names)
+	assert.Contains(t, files["my_app/auth/auth.go"], "package auth")
+	assert.Contains(t, files["my_app/payments/config.txt"], "Feature: payments")
+
+	// nothing is written to the output filesystem
+	entries, err := afero.ReadDir(outFS, "/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLoadTarGz(t *testing.T) {
+	f, err := os.Open("testdata/pack.tar.gz")
+	require.NoError(t, err)
+	defer f.Close()
+
+	templateFS, err := LoadTarGz(f)
+	require.NoError(t, err)
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(templateFS, outFS, map[string]any{"name": "billing"})
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	expected := map[string]string{
+		"out/README.md":       "# billing\n",
+		"out/billing/main.go": "package billing\n",
+		"out/scripts/run.sh":  "#!/bin/sh\necho billing\n",
+	}
+	for path, content := range expected {
+		data, err := afero.ReadFile(outFS, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, content, string(data), path)
+	}
+
+	// the template pack is read-only
+	require.Error(t, afero.WriteFile(templateFS, "template/new.txt", []byte("x"), 0o644))
+}
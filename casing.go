@@ -0,0 +1,95 @@
+package copycat
+
+import (
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// commonInitialisms are the words kept in upper case in Go identifiers, as in the Go code review guidelines
+var commonInitialisms = map[string]bool{
+	"ACL": true, "API": true, "ASCII": true, "CPU": true, "CSS": true, "DNS": true, "EOF": true,
+	"GUID": true, "HTML": true, "HTTP": true, "HTTPS": true, "ID": true, "IP": true, "JSON": true,
+	"LHS": true, "QPS": true, "RAM": true, "RHS": true, "RPC": true, "SLA": true, "SMTP": true,
+	"SQL": true, "SSH": true, "TCP": true, "TLS": true, "TTL": true, "UDP": true, "UI": true,
+	"UID": true, "UUID": true, "URI": true, "URL": true, "UTF8": true, "VM": true, "XML": true,
+	"XMPP": true, "XSRF": true, "XSS": true,
+}
+
+// goExported converts s into an exported Go identifier in PascalCase, keeping initialisms like ID and URL in upper case.
+// A leading digit is prefixed with an underscore.
+//
+// Example: {{ goExported "api url v2" }} renders APIURLV2
+func goExported(s string) string {
+	var b strings.Builder
+	for _, w := range splitWords(s) {
+		upper := strings.ToUpper(w)
+		if commonInitialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		r := []rune(strings.ToLower(w))
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	return safeIdentifier(b.String())
+}
+
+// goPackage converts s into a Go package name: lower case letters and digits only.
+// A leading digit is prefixed with an underscore and reserved words are suffixed with one.
+//
+// Example: {{ goPackage "api url v2" }} renders apiurlv2
+func goPackage(s string) string {
+	name := safeIdentifier(strings.ToLower(strings.Join(splitWords(s), "")))
+	if token.IsKeyword(name) {
+		name += "_"
+	}
+	return name
+}
+
+// goConst converts s into a SCREAMING_SNAKE_CASE constant name.
+// A leading digit is prefixed with an underscore.
+//
+// Example: {{ goConst "api url v2" }} renders API_URL_V2
+func goConst(s string) string {
+	return safeIdentifier(strings.ToUpper(strings.Join(splitWords(s), "_")))
+}
+
+// safeIdentifier prefixes an underscore to identifiers starting with a digit
+func safeIdentifier(s string) string {
+	if s != "" && unicode.IsDigit([]rune(s)[0]) {
+		return "_" + s
+	}
+	return s
+}
+
+// splitWords splits s into words on any character that is not a letter or a digit, and on case changes,
+// e.g. "userID", "user_id" and "user id" all split into "user" and "id" (or "ID"), and "HTTPServer" into "HTTP" and "Server".
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			current = nil
+		}
+	}
+
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && len(current) > 0 {
+			prev := current[len(current)-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				flush()
+			}
+		}
+		current = append(current, r)
+	}
+	flush()
+	return words
+}
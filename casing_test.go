@@ -0,0 +1,33 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoCaseHelpers(t *testing.T) {
+	cc := CopyCat{}
+	rendered, err := cc.renderContent(`{{ goExported .name }} {{ goPackage .name }} {{ goConst .name }}`, map[string]any{"name": "api url v2"})
+	require.NoError(t, err)
+	assert.Equal(t, "APIURLV2 apiurlv2 API_URL_V2", rendered)
+
+	tests := []struct {
+		in       string
+		exported string
+		pkg      string
+		constant string
+	}{
+		{in: "user id", exported: "UserID", pkg: "userid", constant: "USER_ID"},
+		{in: "HTTPServer", exported: "HTTPServer", pkg: "httpserver", constant: "HTTP_SERVER"},
+		{in: "order-items", exported: "OrderItems", pkg: "orderitems", constant: "ORDER_ITEMS"},
+		{in: "2fa codes", exported: "_2faCodes", pkg: "_2facodes", constant: "_2FA_CODES"},
+		{in: "type", exported: "Type", pkg: "type_", constant: "TYPE"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.exported, goExported(tt.in), "goExported(%q)", tt.in)
+		assert.Equal(t, tt.pkg, goPackage(tt.in), "goPackage(%q)", tt.in)
+		assert.Equal(t, tt.constant, goConst(tt.in), "goConst(%q)", tt.in)
+	}
+}
@@ -0,0 +1,109 @@
+package copycat
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// WithCleanOutput removes everything inside the output directory before a run, so that it only holds what the run generates.
+// Unlike WithPrune, which only removes the files recorded in the manifest, files that copycat never generated,
+// like hand written ones, are lost too. Only the content of the output directory is removed, never its siblings,
+// and cleaning the working directory, the root of the OS filesystem or a directory holding the templates is refused.
+// A dry run reports the entries it would remove.
+func WithCleanOutput() Option {
+	return func(cc *CopyCat) {
+		cc.cleanOutput = true
+	}
+}
+
+// WithForce is an intentional override for unattended runs, like in CI, and it is destructive:
+// the output directory is cleaned, like with WithCleanOutput, output files are always overwritten, even in append mode,
+// and the output directory is allowed inside the template directory, though never to be the template directory itself.
+func WithForce() Option {
+	return func(cc *CopyCat) {
+		cc.force = true
+		cc.cleanOutput = true
+	}
+}
+
+// clean removes the content of the output directory of the run
+func (cc *CopyCat) clean(dryRun bool) error {
+	root := cc.run.outRoot
+	absOut, osOutput, err := osPath(cc.outputFS, cc.osOutDir, root)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if osOutput {
+		wd, err := os.Getwd()
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if absOut == wd || absOut == filepath.VolumeName(absOut)+string(filepath.Separator) {
+			return faults.Errorf("refusing to clean the output directory %q", root)
+		}
+	}
+	absTemplate, osTemplates, err := osPath(cc.templateFS, cc.osTemplateDir, cc.run.templateRoot)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if osTemplates && osOutput && isWithinDir(absOut, absTemplate) {
+		return faults.Errorf("refusing to clean the output directory %q, which holds the template directory %q", root, cc.run.templateRoot)
+	}
+
+	exists, err := afero.DirExists(cc.outputFS, root)
+	if err != nil || !exists {
+		return faults.Wrap(err)
+	}
+	entries, err := afero.ReadDir(cc.outputFS, root)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		if dryRun {
+			cc.reportPlanned(ActionRemove, path, 0)
+			continue
+		}
+
+		var files, dirs []string
+		err := afero.Walk(cc.outputFS, path, func(p string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return faults.Wrap(err)
+			}
+			if info.IsDir() {
+				dirs = append(dirs, p)
+			} else {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if err := cc.outputFS.RemoveAll(path); err != nil {
+			return faults.Wrap(err)
+		}
+		for _, f := range files {
+			// the manifest is written again by the run
+			if cc.manifest && f == filepath.Join(root, manifestFile) {
+				continue
+			}
+			cc.recordRemovedFile(f)
+		}
+		// innermost first, like directories left empty are removed
+		for _, d := range slices.Backward(dirs) {
+			cc.recordRemovedDir(d)
+		}
+	}
+	return nil
+}
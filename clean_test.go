@@ -0,0 +1,140 @@
+package copycat
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCleanOutput(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("# {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/src/main.go", []byte("package main\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(outFS, "out/README.md", []byte("# old\n"), 0o644))
+	require.NoError(t, afero.WriteFile(outFS, "out/notes.txt", []byte("hand written"), 0o644))
+	require.NoError(t, afero.WriteFile(outFS, "out/legacy/old.go", []byte("package legacy\n"), 0o644))
+	require.NoError(t, afero.WriteFile(outFS, "other/keep.txt", []byte("sibling"), 0o644))
+
+	// a dry run only reports what would be removed
+	var plan bytes.Buffer
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "app"}, WithCleanOutput(), WithOutput(&plan))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", true))
+	assert.Contains(t, plan.String(), "[REMOVE] out/legacy\n[REMOVE] out/notes.txt\n")
+	exists, err := afero.Exists(outFS, "out/notes.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	require.NoError(t, cc.Run("template", "out", false))
+
+	for path, want := range map[string]bool{
+		"out/README.md":     true,
+		"out/src/main.go":   true,
+		"out/notes.txt":     false,
+		"out/legacy":        false,
+		"other/keep.txt":    true,
+		"out/legacy/old.go": false,
+	} {
+		exists, err := afero.Exists(outFS, path)
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, path)
+	}
+	data, err := afero.ReadFile(outFS, "out/README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# app\n", string(data))
+
+	result := cc.Result()
+	assert.ElementsMatch(t, []string{"README.md", "src/main.go"}, result.CreatedFiles)
+	assert.Equal(t, []string{"src"}, result.CreatedDirs)
+	assert.ElementsMatch(t, []string{"legacy/old.go", "notes.txt"}, result.RemovedFiles)
+	assert.Equal(t, []string{"legacy"}, result.RemovedDirs)
+}
+
+func TestCleanOutputRefusesWorkingDirectory(t *testing.T) {
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewOsFs(), map[string]any{}, WithCleanOutput())
+	require.NoError(t, err)
+
+	// called directly, so that a broken guard never gets to the rest of a run
+	for _, root := range []string{".", "", "/"} {
+		cc.run = runState{outRoot: root}
+		err = cc.clean(false)
+		assert.ErrorContains(t, err, "refusing to clean", root)
+	}
+}
+
+func TestCleanOutputRefusesWorkingDirectoryFromDir(t *testing.T) {
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "README.md"), []byte("# {{ .name }}\n"), 0o644))
+	outDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "notes.txt"), []byte("keep"), 0o644))
+	t.Chdir(outDir)
+
+	// the output filesystem is rooted at the working directory
+	cc, err := NewFromDir(templateDir, ".", map[string]any{"name": "app"}, WithCleanOutput())
+	require.NoError(t, err)
+	err = cc.Generate(false)
+	assert.ErrorContains(t, err, "refusing to clean")
+
+	data, err := os.ReadFile(filepath.Join(outDir, "notes.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+}
+
+func TestCleanOutputRefusesTemplateDirectory(t *testing.T) {
+	outDir := t.TempDir()
+	templateDir := filepath.Join(outDir, "tpl")
+	require.NoError(t, os.MkdirAll(templateDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "README.md"), []byte("# {{ .name }}\n"), 0o644))
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewOsFs(), map[string]any{"name": "app"}, WithCleanOutput())
+	require.NoError(t, err)
+	err = cc.Run(templateDir, outDir, false)
+	assert.ErrorContains(t, err, "refusing to clean")
+
+	// the templates are left untouched
+	data, err := os.ReadFile(filepath.Join(templateDir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# {{ .name }}\n", string(data))
+}
+
+func TestForce(t *testing.T) {
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "README.md"), []byte("# {{ .name }}\n"), 0o644))
+	outDir := filepath.Join(templateDir, "out")
+	require.NoError(t, os.MkdirAll(outDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "README.md"), []byte("# old\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "stale.txt"), []byte("stale"), 0o644))
+
+	model := map[string]any{"name": "app"}
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewOsFs(), model, WithWriteMode(WriteModeAppend))
+	require.NoError(t, err)
+	assert.ErrorIs(t, cc.Run(templateDir, outDir, false), ErrOutputOverlap)
+
+	cc, err = NewCopyCat(afero.NewOsFs(), afero.NewOsFs(), model, WithWriteMode(WriteModeAppend), WithForce())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run(templateDir, outDir, false))
+
+	// the output is cleaned and overwritten, and never read as a template
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	data, err := os.ReadFile(filepath.Join(outDir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# app\n", string(data))
+
+	// running again does not append
+	require.NoError(t, cc.Run(templateDir, outDir, false))
+	data, err = os.ReadFile(filepath.Join(outDir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# app\n", string(data))
+
+	// the template directory itself is never the output
+	assert.ErrorIs(t, cc.Run(templateDir, templateDir, false), ErrOutputOverlap)
+}
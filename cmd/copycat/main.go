@@ -11,15 +11,40 @@ import (
 
 func main() {
 	// Command-line flags
-	modelFile := flag.String("model", "", "YAML model file")
+	modelFile := flag.String("model", "", "YAML model file, or directory of YAML/JSON model files")
+	defaultsFile := flag.String("defaults", "", "YAML file with default values for the keys missing from the model")
 	templateDir := flag.String("template", "", "Template directory")
 	outputDir := flag.String("out", "", "Output directory")
 	dryRun := flag.Bool("dry-run", false, "Print actions without writing files")
+	quiet := flag.Bool("quiet", false, "Do not print informational output, only errors")
+	watch := flag.Bool("watch", false, "Regenerate the output whenever the templates change")
+	force := flag.Bool("force", false, "DESTRUCTIVE: clean the output directory, always overwrite and allow the output inside the template directory")
+	var setJSON []string
+	flag.Func("set-json", "Merge a JSON value into the model at a key path, like features=[{\"name\":\"auth\"}] (repeatable)", func(v string) error {
+		setJSON = append(setJSON, v)
+		return nil
+	})
+	var allowEnv []string
+	flag.Func("allow-env", "Environment variable that templates can read with envOr (repeatable)", func(v string) error {
+		allowEnv = append(allowEnv, v)
+		return nil
+	})
 	flag.Parse()
 
-	// Load model from YAML file
-	model, err := copycat.LoadModel(*modelFile)
-	noError(err, "failed to load model: %+v", err)
+	// Load model from YAML file, or from all the model files of a directory
+	var model map[string]any
+	if info, err := os.Stat(*modelFile); err == nil && info.IsDir() {
+		model, err = copycat.LoadModelDir(*modelFile)
+		noError(err, "failed to load model: %+v", err)
+	} else {
+		model, err = copycat.LoadModel(*modelFile)
+		noError(err, "failed to load model: %+v", err)
+	}
+
+	for _, assignment := range setJSON {
+		err := copycat.SetJSON(model, assignment)
+		noError(err, "failed to set model value: %+v", err)
+	}
 
 	info, err := os.Stat(*templateDir)
 	noError(err, "template dir error: %+v", err)
@@ -29,22 +54,49 @@ func main() {
 
 	// Ensure output directory exists (or would exist in dry-run mode)
 	if *dryRun {
-		fmt.Printf("DRY-RUN: would ensure output dir %s exists\n", *outputDir)
+		if !*quiet {
+			fmt.Printf("DRY-RUN: would ensure output dir %s exists\n", *outputDir)
+		}
 	} else {
 		err = os.MkdirAll(*outputDir, 0o755)
 		noError(err, "failed to create output dir: %+v", err)
 	}
 
+	var options []copycat.Option
+	if *quiet {
+		options = append(options, copycat.WithQuiet())
+	}
+	if *force {
+		options = append(options, copycat.WithForce())
+	}
+	if len(allowEnv) > 0 {
+		options = append(options, copycat.WithEnvAllowlist(allowEnv...))
+	}
+	if *defaultsFile != "" {
+		defaults, err := copycat.LoadModel(*defaultsFile)
+		noError(err, "failed to load defaults: %+v", err)
+		options = append(options, copycat.WithDefaults(defaults))
+	}
 	cc, err := copycat.NewCopyCat(
 		afero.NewOsFs(),
 		afero.NewOsFs(),
 		model,
+		options...,
 	)
 	noError(err, "failed to create CopyCat: %+v", err)
 
+	if *watch && !*dryRun {
+		err = cc.Watch(*templateDir, *outputDir)
+		noError(err, "failed to watch templates: %+v", err)
+		return
+	}
+
 	err = cc.Run(*templateDir, *outputDir, *dryRun)
 	noError(err, "failed to process directory: %+v", err)
 
+	if *quiet {
+		return
+	}
 	if *dryRun {
 		fmt.Println("Dry-run complete. No files written.")
 	} else {
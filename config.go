@@ -0,0 +1,74 @@
+package copycat
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// templateConfigFile is the optional configuration file at the root of a template tree.
+// It is never copied to the output.
+const templateConfigFile = ".copycat.yaml"
+
+// TemplateConfig is the configuration of a template tree, read from the .copycat.yaml file at its root
+type TemplateConfig struct {
+	// Include lists the globs of the output paths, relative to the output root, to generate.
+	// When empty, everything is generated. A file is included if its path, or the path of any of its directories, matches.
+	Include []string `yaml:"include"`
+	// Exclude lists the globs of the output paths, relative to the output root, to skip.
+	// An excluded directory is skipped with all its content.
+	Exclude []string `yaml:"exclude"`
+}
+
+// loadTemplateConfig reads the template configuration at the root of the template tree, if any
+func (cc *CopyCat) loadTemplateConfig(templatePath string) (TemplateConfig, error) {
+	var cfg TemplateConfig
+
+	file := filepath.Join(templatePath, templateConfigFile)
+	exists, err := afero.Exists(cc.templateFS, file)
+	if err != nil {
+		return cfg, faults.Wrap(err)
+	}
+	if !exists {
+		return cfg, nil
+	}
+
+	data, err := afero.ReadFile(cc.templateFS, file)
+	if err != nil {
+		return cfg, faults.Wrap(err)
+	}
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, faults.Wrapf(err, "parsing %s", file)
+	}
+	return cfg, nil
+}
+
+// excluded reports whether the output path, relative to the output root, matches an exclude glob
+func (c TemplateConfig) excluded(rel string) bool {
+	return matchAny(c.Exclude, rel)
+}
+
+// included reports whether the output file, relative to the output root, or any of its directories, matches an include glob
+func (c TemplateConfig) included(rel string) bool {
+	if len(c.Include) == 0 {
+		return true
+	}
+	for p := rel; p != "." && p != "/" && p != ""; p = path.Dir(p) {
+		if matchAny(c.Include, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(globs []string, name string) bool {
+	for _, g := range globs {
+		if ok, _ := path.Match(g, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package copycat
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateConfigExclude(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/.copycat.yaml", []byte("exclude:\n  - \"*/payments\"\n"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ name }}/{{ features.name }}/{{ name }}.go.tmpl", []byte("package {{ .name }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"name": "app",
+		"features": []any{
+			map[string]any{"name": "auth"},
+			map[string]any{"name": "payments"},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	_, err = outFS.Stat("out/app/auth/auth.go")
+	assert.NoError(t, err, "auth should be generated")
+	_, err = outFS.Stat("out/app/payments")
+	assert.True(t, os.IsNotExist(err), "payments should be excluded")
+	_, err = outFS.Stat("out/.copycat.yaml")
+	assert.True(t, os.IsNotExist(err), "the template config should not be copied")
+}
+
+func TestTemplateConfigInclude(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/.copycat.yaml", []byte("include:\n  - auth\n  - README.md\n"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/README.md", []byte("readme"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/LICENSE", []byte("license"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte("package {{ .name }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "auth"},
+			map[string]any{"name": "payments"},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	_, err = outFS.Stat("out/auth/auth.go")
+	assert.NoError(t, err, "auth should be generated")
+	_, err = outFS.Stat("out/README.md")
+	assert.NoError(t, err, "README.md should be generated")
+	_, err = outFS.Stat("out/LICENSE")
+	assert.True(t, os.IsNotExist(err), "LICENSE should not be included")
+	_, err = outFS.Stat("out/payments")
+	assert.True(t, os.IsNotExist(err), "payments should not be included")
+}
+
+func TestTemplateConfigMatchesGeneratedFileNames(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(inFS, "template/.copycat.yaml", []byte("exclude:\n  - \"*/*_test.go\"\n  - run.sh\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte("package {{ .name }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}_test.go.tmpl", []byte("package {{ .name }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/run.sh@exec", []byte("#!/bin/sh"), 0o644))
+
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "auth"},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	_, err = outFS.Stat("out/auth/auth.go")
+	assert.NoError(t, err, "auth.go should be generated")
+	_, err = outFS.Stat("out/auth/auth_test.go")
+	assert.True(t, os.IsNotExist(err), "the template should be excluded by its output name")
+	_, err = outFS.Stat("out/run.sh")
+	assert.True(t, os.IsNotExist(err), "the file should be excluded without its markers")
+}
@@ -2,237 +2,1438 @@ package copycat
 
 import (
 	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"maps"
+	"math/rand"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	sprig "github.com/go-task/slim-sprig/v3"
 	"github.com/quintans/faults"
 	"github.com/spf13/afero"
-	"gopkg.in/yaml.v3"
 )
 
 // LoadModel reads a YAML file into a map
-func LoadModel(filename string) (map[string]any, error) {
+func LoadModel(filename string, options ...LoadOption) (map[string]any, error) {
 	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, faults.Wrap(&ModelLoadError{Path: filename, Err: err})
+	}
+
+	model, err := newLoadOptions(options).decode(data)
+	if err != nil {
+		return nil, faults.Wrap(&ModelLoadError{Path: filename, Err: err})
+	}
+	return normalizeModel(model), nil
+}
+
+// defaultTemplateSuffix is the suffix trimmed from template file names when none is configured
+const defaultTemplateSuffix = ".tmpl"
+
+// keepMarker is a template file flagging that its directory must be kept even when empty
+const keepMarker = ".keep"
+
+// execMarker at the end of a template file name, like deploy.sh@exec, makes the output file executable.
+// It can come before or after the template suffix and is stripped from the output name.
+const execMarker = "@exec"
+
+// keepSuffixMarker at the end of a template file name, like gitignore.tmpl@keep, keeps the template suffix in the output name,
+// e.g. to generate templates. It comes before the exec marker, if any, and is stripped from the output name.
+const keepSuffixMarker = "@keep"
+
+const (
+	defaultFileMode os.FileMode = 0o644
+	defaultDirMode  os.FileMode = 0o755
+	execFileMode    os.FileMode = 0o755
+)
+
+type CopyCat struct {
+	templateFS afero.Fs
+	outputFS   afero.Fs
+	// osTemplateDir and osOutDir are the OS directories the filesystems are rooted at, when created by NewFromDir
+	osTemplateDir string
+	osOutDir      string
+	model         map[string]any
+	customFuncs   template.FuncMap
+	// fileMode and dirMode are the explicitly configured output permissions. Zero means not set.
+	fileMode        os.FileMode
+	dirMode         os.FileMode
+	maxFileSize     int64
+	trailingNewline TrailingNewline
+	emptyFiles      EmptyFiles
+	trimEmptyCheck  bool
+	mergeRegions    bool
+	// skipModelRendering disables rendering the model string values as templates
+	skipModelRendering bool
+	planOutput         io.Writer
+	output             io.Writer
+	templateSuffixes   []string
+	templateSegments   bool
+	fanOutOrder        string
+	defaults           map[string]any
+	writeMode          WriteMode
+	appendSeparator    string
+	renderOnlySuffixed bool
+	strictPaths        bool
+	outputPrefix       string
+	progress           func(done, total int, path string)
+	manifest           bool
+	prune              bool
+	cleanOutput        bool
+	force              bool
+	collapseBlankLines bool
+	nameTransform      func(path string) string
+	caseInsensitive    bool
+	fileDir            string
+	randSeed           *int64
+	location           *time.Location
+	fixedTime          *time.Time
+	// modelPasses tracks the model rendering, while rendering it
+	modelPasses     *modelPasses
+	envAllowlist    map[string]bool
+	quiet           bool
+	generatedHeader *generatedHeader
+	rawModelKeys    []string
+	module          string
+	funcProvider    *funcProvider
+	goFormat        bool
+	formatData      bool
+	trackUsage      bool
+	// eagerParse holds the template directories to parse on creation, when set
+	eagerParse []string
+	// used holds the key paths accessed by path placeholders and templates, when tracking usage
+	used map[string]bool
+	// funcs caches the template functions, bound to this CopyCat
+	funcs template.FuncMap
+	// current is what is being rendered, for the template functions depending on it
+	current renderState
+	// templates caches the parsed templates by the hash of their content, bound to funcs
+	templates map[[sha256.Size]byte]*template.Template
+	// parses counts the templates parsed
+	parses int
+
+	run runState
+}
+
+// runState holds the state of the current run
+type runState struct {
+	templateRoot string
+	outRoot      string
+	config       TemplateConfig
+	// nestedOut is the output directory of a forced run inside the template directory, which is not a template
+	nestedOut string
+	// plan holds the actions of a dry run, when planOutput is set
+	plan []PlannedAction
+	// planned counts the files and directories a dry run would leave in the output
+	planned int
+	// plannedRemovals holds the paths a dry run would remove
+	plannedRemovals map[string]bool
+	// done and total track the progress, when a progress callback is set
+	done  int
+	total int
+	// result is what the run changed in the output
+	result Result
+	// generated holds the files written by the run
+	generated []manifestEntry
+	// sources maps the output files of the run to the template file generating them
+	sources map[string]string
+	// folded maps the lower case output paths of the run to their path, when checking for case collisions
+	folded map[string]string
+	// rand is the random source, when seeded
+	rand *rand.Rand
+}
+
+type Option func(*CopyCat)
+
+func WithCustomFuncs(funcs template.FuncMap) Option {
+	return func(cc *CopyCat) {
+		cc.customFuncs = funcs
+	}
+}
+
+// funcProvider lazily builds template functions, only once
+type funcProvider struct {
+	once     sync.Once
+	provider func() template.FuncMap
+	built    template.FuncMap
+}
+
+func (p *funcProvider) funcs() template.FuncMap {
+	p.once.Do(func() {
+		p.built = p.provider()
+	})
+	return p.built
+}
+
+// WithFuncMapProvider registers template functions built by provider, called once on the first render.
+// Use it for functions that are expensive to set up, like the ones needing a database connection.
+// Functions registered with WithCustomFuncs take precedence.
+func WithFuncMapProvider(provider func() template.FuncMap) Option {
+	return func(cc *CopyCat) {
+		cc.funcProvider = &funcProvider{provider: provider}
+	}
+}
+
+// WithModelRendering enables or disables rendering the string values of the model as templates
+// when creating the CopyCat. Disable it when the model has literal "{{ }}" values. Defaults to true.
+func WithModelRendering(enabled bool) Option {
+	return func(cc *CopyCat) {
+		cc.skipModelRendering = !enabled
+	}
+}
+
+// WithDefaults deep merges the model over default values, so that the keys missing from the model get the default ones.
+// Model values win, with nested maps merged key by key. Defaults can be loaded from a file with LoadModel.
+func WithDefaults(defaults map[string]any) Option {
+	return func(cc *CopyCat) {
+		cc.defaults = defaults
+	}
+}
+
+// WithRawModelKeys excludes model values from being rendered when creating the CopyCat, so that they reach
+// the file rendering verbatim, e.g. a template snippet to be rendered per file with {{ tpl .snippet . }}.
+// Keys are dotted paths, like "projectSlug" or "features.template" for the field of every element of an array.
+func WithRawModelKeys(keys ...string) Option {
+	return func(cc *CopyCat) {
+		cc.rawModelKeys = keys
+	}
+}
+
+// WithTemplateSuffix sets the file name suffixes that identify templates, which are trimmed from the output name.
+// Defaults to ".tmpl".
+func WithTemplateSuffix(suffixes ...string) Option {
+	return func(cc *CopyCat) {
+		cc.templateSuffixes = suffixes
+	}
+}
+
+// WithTemplateSegments also identifies as templates the files having a template suffix in the middle of the name,
+// as a dot separated segment, like notes.tmpl.md, removing exactly one segment from the output name (notes.md).
+// A trailing suffix takes precedence. Suffixes not starting with a dot only match at the end.
+func WithTemplateSegments() Option {
+	return func(cc *CopyCat) {
+		cc.templateSegments = true
+	}
+}
+
+// WithRenderOnlySuffixed restricts rendering to files with a template suffix (see WithTemplateSuffix).
+// All other files are copied byte for byte, even when empty.
+func WithRenderOnlySuffixed() Option {
+	return func(cc *CopyCat) {
+		cc.renderOnlySuffixed = true
+	}
+}
+
+// WithModulePath sets the Go module of the output directory, used by the modulePath helper to build import paths,
+// e.g. "github.com/acme/shop"
+func WithModulePath(module string) Option {
+	return func(cc *CopyCat) {
+		cc.module = strings.TrimSuffix(module, "/")
+	}
+}
+
+// WithNameTransform sets a function rewriting the path of every generated file and directory after expansion,
+// e.g. to lowercase it. The path is relative to the output directory, with forward slashes and without template suffix.
+// Directories are transformed before their content, so the path of a file already has its directories transformed.
+// Returning an empty string skips the entry.
+func WithNameTransform(fn func(path string) string) Option {
+	return func(cc *CopyCat) {
+		cc.nameTransform = fn
+	}
+}
+
+// WithFileDir sets the directory the file helper reads from. Files outside of it cannot be read.
+// Defaults to the working directory.
+func WithFileDir(dir string) Option {
+	return func(cc *CopyCat) {
+		cc.fileDir = dir
+	}
+}
+
+// WithFanOutOrder sorts the elements fanned out by path placeholders by one of their fields, like a numeric weight,
+// instead of following the array order. Ties, and elements without the field, which go last, keep the array order.
+func WithFanOutOrder(field string) Option {
+	return func(cc *CopyCat) {
+		cc.fanOutOrder = field
+	}
+}
+
+// WithStrictPaths makes a path placeholder that does not resolve to any value an error,
+// catching typos like {{ projetName }}. Placeholders fanning out an empty array still produce no entries.
+func WithStrictPaths() Option {
+	return func(cc *CopyCat) {
+		cc.strictPaths = true
+	}
+}
+
+// WithOutputPrefix roots all the output under a subdirectory of the output path.
+// The prefix is a template rendered against the model, e.g. "services/{{ .projectSlug }}".
+func WithOutputPrefix(prefix string) Option {
+	return func(cc *CopyCat) {
+		cc.outputPrefix = prefix
+	}
+}
+
+// WithFileMode sets the permissions of the generated files. Defaults to 0644.
+func WithFileMode(mode os.FileMode) Option {
+	return func(cc *CopyCat) {
+		cc.fileMode = mode
+	}
+}
+
+// WithDirMode sets the permissions of the generated directories. Defaults to 0755.
+func WithDirMode(mode os.FileMode) Option {
+	return func(cc *CopyCat) {
+		cc.dirMode = mode
+	}
+}
+
+// WithMaxFileSize fails a run on a template file larger than size bytes, before reading it all,
+// guarding against runaway templates. Files copied verbatim, with WithRenderOnlySuffixed, are streamed and not limited.
+func WithMaxFileSize(size int64) Option {
+	return func(cc *CopyCat) {
+		cc.maxFileSize = size
+	}
+}
+
+func NewCopyCat(templateFS, outputFS afero.Fs, model map[string]any, options ...Option) (*CopyCat, error) {
+	cc := &CopyCat{
+		model:      model,
+		templateFS: templateFS,
+		outputFS:   outputFS,
+	}
+	for _, opt := range options {
+		opt(cc)
+	}
+
+	if cc.defaults != nil {
+		cc.model = normalizeModel(cc.defaults)
+		deepMerge(cc.model, normalizeModel(model))
+		model = cc.model
+	}
+
+	if !cc.skipModelRendering {
+		cc.resetRand()
+
+		if err := cc.checkModelCycles(model); err != nil {
+			return nil, faults.Wrap(err)
+		}
+
+		m, err := cc.renderModel(model)
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+		cc.model = m
+	}
+
+	if cc.eagerParse != nil {
+		if err := cc.parseTrees(cc.eagerParse); err != nil {
+			return nil, faults.Wrap(err)
+		}
+	}
+
+	return cc, nil
+}
+
+// NewFromDir creates a CopyCat reading the templates from a directory of the OS filesystem and writing to another one.
+// Both filesystems are rooted at their directory, so the CopyCat is run with Generate.
+func NewFromDir(templateDir, outDir string, model map[string]any, options ...Option) (*CopyCat, error) {
+	// BasePathFs rejects the names of a relative base, like "."
+	templateDir, err := filepath.Abs(templateDir)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	outDir, err = filepath.Abs(outDir)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	osFs := afero.NewOsFs()
+	cc, err := NewCopyCat(afero.NewBasePathFs(osFs, templateDir), afero.NewBasePathFs(osFs, outDir), model, options...)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	// so that overlapping directories are still detected
+	cc.osTemplateDir = templateDir
+	cc.osOutDir = outDir
+	return cc, nil
+}
+
+// Generate runs the whole template filesystem into the root of the output filesystem, creating it if needed.
+// It is the way to run a CopyCat created with NewFromDir or NewCopyCatFromFS.
+func (cc *CopyCat) Generate(dryRun bool) error {
+	// before creating the output directory inside the templates
+	if _, err := cc.checkOverlap(".", "."); err != nil {
+		return faults.Wrap(err)
+	}
+	if !dryRun {
+		if err := cc.outputFS.MkdirAll(".", cc.outputDirMode()); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+	return cc.Run(".", ".", dryRun)
+}
+
+// NewCopyCatFromFS creates a CopyCat reading the templates from any fs.FS, like an embed.FS.
+// root is the directory of fsys holding the template tree, e.g. "template" for a //go:embed template directive,
+// so that the output paths do not start with it. Run it with "." as the template path, or with Generate.
+func NewCopyCatFromFS(fsys fs.FS, root string, outputFS afero.Fs, model map[string]any, options ...Option) (*CopyCat, error) {
+	root = path.Clean(strings.Trim(filepath.ToSlash(root), "/"))
+	if root != "." {
+		sub, err := fs.Sub(fsys, root)
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+		fsys = sub
+	}
+	return NewCopyCat(afero.FromIOFS{FS: fsys}, outputFS, model, options...)
+}
+
+// renderModelValue renders the string values of the model node, at the model path, as templates.
+// For strings, dot is the enclosing node, while for maps and arrays it is the node itself,
+// both as rendered by the previous pass so that values can depend on other rendered values.
+func (cc *CopyCat) renderModelValue(path string, dot, value any) (any, error) {
+	switch v := value.(type) {
+	case string:
+		// plain strings render to themselves, so they are not worth parsing
+		if !strings.Contains(v, "{{") || cc.isRawModelKey(path) {
+			return v, nil
+		}
+		return cc.renderContent(v, dot)
+	case map[string]any:
+		current, ok := dot.(map[string]any)
+		if !ok {
+			current = v
+		}
+		newMap := make(map[string]any, len(v))
+		for mk, mv := range v {
+			renderedVal, err := cc.renderModelChild(joinModelPath(path, mk), current, current[mk], mv)
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			newMap[mk] = renderedVal
+		}
+		return newMap, nil
+	case []any:
+		current, ok := dot.([]any)
+		if !ok || len(current) != len(v) {
+			current = v
+		}
+		newArr := make([]any, len(v))
+		for k, item := range v {
+			renderedItem, err := cc.renderModelChild(fmt.Sprintf("%s[%d]", path, k), current, current[k], item)
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			newArr[k] = renderedItem
+		}
+		return newArr, nil
+	default:
+		return v, nil
+	}
+}
+
+// childDot returns the dot to render a child value with: the enclosing node for strings or the child itself otherwise
+func childDot(parent, child, value any) any {
+	if _, ok := value.(string); ok {
+		return parent
+	}
+	return child
+}
+
+func (cc *CopyCat) Run(templatePath string, outPath string, dryRun bool) error {
+	started := time.Now()
+	nestedOut, err := cc.checkOverlap(templatePath, outPath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	cfg, err := cc.loadTemplateConfig(templatePath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	outPath, createdPrefix, err := cc.applyOutputPrefix(outPath, dryRun)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	cc.run = runState{
+		templateRoot: templatePath,
+		outRoot:      outPath,
+		config:       cfg,
+		nestedOut:    nestedOut,
+	}
+	cc.resetRand()
+
+	if cc.cleanOutput {
+		if err := cc.clean(dryRun); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+
+	frames := []contextFrame{{ctx: cc.model}}
+	if cc.progress != nil {
+		total, err := cc.countEntries(templatePath, outPath, frames)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		cc.run.total = total
+	}
+
+	var previous manifest
+	if cc.manifest && !dryRun {
+		previous, err = cc.loadManifest()
+		if err != nil {
+			return faults.Wrap(err)
+		}
+	}
+
+	if err := cc.processDir(templatePath, outPath, frames, dryRun); err != nil {
+		return faults.Wrap(err)
+	}
+
+	if cc.manifest && !dryRun {
+		if err := cc.removeOrphans(previous); err != nil {
+			return faults.Wrap(err)
+		}
+		if err := cc.writeManifest(); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+
+	// like any other directory created by copycat, the prefix directory is removed if nothing was generated into it
+	if createdPrefix {
+		if _, err := cc.removeIfEmpty(outPath); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+
+	cc.run.result.Elapsed = time.Since(started)
+	if dryRun {
+		return cc.writePlan()
+	}
+	return nil
+}
+
+// osPath returns the absolute OS path of a path of the filesystem, and whether it is in the OS filesystem,
+// either directly or under the OS directory dir the filesystem is rooted at, if any
+func osPath(fsys afero.Fs, dir, path string) (string, bool, error) {
+	if _, ok := fsys.(*afero.OsFs); !ok {
+		if dir == "" {
+			return "", false, nil
+		}
+		path = filepath.Join(dir, path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false, faults.Wrap(err)
+	}
+	return abs, true, nil
+}
+
+// checkOverlap fails when both the templates and the output are in the OS filesystem, like with NewFromDir,
+// and the output directory is the template directory or is inside it.
+// Forced runs allow the output inside the template directory, returning its template path, so that it is not read as a template.
+func (cc *CopyCat) checkOverlap(templatePath, outPath string) (string, error) {
+	absTemplate, osTemplates, err := osPath(cc.templateFS, cc.osTemplateDir, templatePath)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	absOut, osOutput, err := osPath(cc.outputFS, cc.osOutDir, outPath)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	if !osTemplates || !osOutput || !isWithinDir(absTemplate, absOut) {
+		return "", nil
+	}
+	if rel, _ := filepath.Rel(absTemplate, absOut); cc.force && rel != "." {
+		return filepath.Join(templatePath, rel), nil
+	}
+	return "", faults.Wrap(&OutputOverlapError{TemplatePath: templatePath, OutPath: outPath})
+}
+
+// ProcessDir processes a template directory and writes output to outFS
+//
+// This function is made public to allow creating other projects to call it directly.
+//
+// frames is the chain of contexts the current directory was fanned out from, the last being the current context.
+func (cc *CopyCat) processDir(currentTemplatePath string, currentOutPath string, frames []contextFrame, dryRun bool) error {
+	items, err := cc.listEntries(currentTemplatePath, currentOutPath, frames)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	for _, item := range items {
+		outPath := item.outPath
+
+		if item.isDir && outPath == currentOutPath {
+			// a directory named only by a {{ =key }} placeholder just rebinds the context of its entries
+			if err := cc.processDir(item.templatePath, outPath, item.frames, dryRun); err != nil {
+				return faults.Wrap(err)
+			}
+			continue
+		}
+
+		if item.isDir {
+			if err := cc.claimCase(outPath); err != nil {
+				return faults.Wrap(err)
+			}
+			cc.reportProgress(outPath)
+			planned := cc.run.planned
+			if dryRun {
+				cc.reportPlanned(ActionDir, outPath, 0)
+				planned = cc.run.planned
+			} else {
+				exists, err := afero.DirExists(cc.outputFS, outPath)
+				if err != nil {
+					return faults.Wrap(err)
+				}
+				if err := cc.outputFS.MkdirAll(outPath, cc.outputDirMode()); err != nil {
+					return faults.Wrap(err)
+				}
+				if !exists {
+					cc.recordCreatedDir(outPath)
+				}
+			}
+			err = cc.processDir(item.templatePath, outPath, item.frames, dryRun)
+			if err != nil {
+				return faults.Wrap(err)
+			}
+
+			keep, err := afero.Exists(cc.templateFS, filepath.Join(item.templatePath, keepMarker))
+			if err != nil {
+				return faults.Wrap(err)
+			}
+
+			if dryRun && !keep {
+				if err := cc.planRemoveIfEmpty(outPath, planned); err != nil {
+					return faults.Wrap(err)
+				}
+			}
+
+			// After processing the directory, check if it is empty and remove if so
+			// We do this here to avoid removing directories that were not created by copycat
+			if !dryRun && !keep {
+				removed, err := cc.removeIfEmpty(outPath)
+				if err != nil {
+					return faults.Wrap(err)
+				}
+				if removed {
+					cc.recordRemovedDir(outPath)
+				}
+			}
+
+			continue
+		}
+
+		name := cc.parseFileName(outPath)
+		transformed, ok, err := cc.transformName(item.templatePath, name.path)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if !ok {
+			cc.reportProgress(name.path)
+			continue
+		}
+		name.path = transformed
+		cc.reportProgress(name.path)
+
+		if err := cc.claimOutput(name.path, item.templatePath); err != nil {
+			return faults.Wrap(err)
+		}
+
+		scope := renderScope{
+			templateDir: currentTemplatePath,
+			parent:      parentContext(item.frames),
+			frame:       item.frames[len(item.frames)-1],
+			dirFrame:    frames[len(frames)-1],
+		}
+		if err := cc.processFile(item.templatePath, name, item.ctx, scope, dryRun); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// entryItem is an expansion of a template directory entry to be generated
+type entryItem struct {
+	expandedPath
+	isDir        bool
+	templatePath string
+	outPath      string
+}
+
+// listEntries expands the entries of a template directory into the items to generate, in a deterministic order,
+// leaving out the ones that are not to be generated.
+func (cc *CopyCat) listEntries(currentTemplatePath string, currentOutPath string, frames []contextFrame) ([]entryItem, error) {
+	entries, err := cc.readTemplateDir(currentTemplatePath)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+
+	var items []entryItem
+	for _, entry := range entries {
+		entryItems, err := cc.listEntry(currentTemplatePath, currentOutPath, entry, frames)
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+		items = append(items, entryItems...)
+	}
+	return items, nil
+}
+
+// readTemplateDir reads the entries of a template directory, sorted by name
+func (cc *CopyCat) readTemplateDir(templatePath string) ([]fs.FileInfo, error) {
+	entries, err := afero.ReadDir(cc.templateFS, templatePath) // Pre-check to ensure templatePath exists
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	// do not rely on the Fs implementation for the ordering, so that the output is stable across runs
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// listEntry expands a template directory entry into the items to generate, leaving out the ones that are not to be generated.
+func (cc *CopyCat) listEntry(currentTemplatePath string, currentOutPath string, entry fs.FileInfo, frames []contextFrame) ([]entryItem, error) {
+	// the keep marker only flags its directory to be preserved and is never copied
+	if !entry.IsDir() && entry.Name() == keepMarker {
+		return nil, nil
+	}
+	if currentTemplatePath == cc.run.templateRoot && entry.Name() == templateConfigFile {
+		return nil, nil
+	}
+	if entry.IsDir() && cc.run.nestedOut != "" && filepath.Join(currentTemplatePath, entry.Name()) == cc.run.nestedOut {
+		return nil, nil
+	}
+
+	cc.trackName(entry.Name(), frames)
+	name := entry.Name()
+	if entry.IsDir() {
+		var open bool
+		// a closed gate skips the whole subtree, which is never created
+		if name, open = openGate(name, frames); !open {
+			return nil, nil
+		}
+	}
+
+	expanded, err := expandPathInFrames(name, frames, cc.strictPaths, cc.fanOutOrder, cc.pipePath)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+
+	var items []entryItem
+	for _, item := range expanded {
+		outPath := filepath.Join(currentOutPath, item.value)
+		// models may come from untrusted sources, so expansions cannot climb out of the output directory
+		if !isWithinDir(currentOutPath, outPath) {
+			return nil, faults.Wrap(&PathEscapeError{Name: entry.Name(), Path: outPath})
+		}
+		if entry.IsDir() {
+			transformed, ok, err := cc.transformName(entry.Name(), outPath)
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			if !ok {
+				continue
+			}
+			outPath = transformed
+		}
+
+		rel := cc.relOutPath(outPath)
+		if !entry.IsDir() {
+			// files are matched by the path they generate, without the template suffix and markers
+			generated, ok, err := cc.transformName(filepath.Join(currentTemplatePath, entry.Name()), cc.parseFileName(outPath).path)
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			if ok {
+				rel = cc.relOutPath(generated)
+			}
+		}
+		if cc.run.config.excluded(rel) || (!entry.IsDir() && !cc.run.config.included(rel)) {
+			continue
+		}
+
+		items = append(items, entryItem{
+			expandedPath: item,
+			isDir:        entry.IsDir(),
+			templatePath: filepath.Join(currentTemplatePath, entry.Name()),
+			outPath:      outPath,
+		})
+	}
+	return items, nil
+}
+
+// claimOutput records the template file generating an output file, failing if another template file already generates it
+func (cc *CopyCat) claimOutput(outPath, templateFile string) error {
+	if cc.run.sources == nil {
+		cc.run.sources = map[string]string{}
+	}
+	if other, ok := cc.run.sources[outPath]; ok && other != templateFile {
+		return faults.Wrap(&OutputConflictError{Path: outPath, First: other, Second: templateFile})
+	}
+	cc.run.sources[outPath] = templateFile
+	return cc.claimCase(outPath)
+}
+
+// WithCaseInsensitiveOutput fails a run that generates two output paths differing only by case, like Auth and auth,
+// which would collide on case-insensitive filesystems, like the default ones of macOS and Windows.
+func WithCaseInsensitiveOutput() Option {
+	return func(cc *CopyCat) {
+		cc.caseInsensitive = true
+	}
+}
+
+// claimCase records an output file or directory path, when checking for case collisions,
+// failing if another path of the run differs from it only by case
+func (cc *CopyCat) claimCase(outPath string) error {
+	if !cc.caseInsensitive {
+		return nil
+	}
+	if cc.run.folded == nil {
+		cc.run.folded = map[string]string{}
+	}
+	folded := strings.ToLower(outPath)
+	if other, ok := cc.run.folded[folded]; ok && other != outPath {
+		return faults.Wrap(&CaseConflictError{First: other, Second: outPath})
+	}
+	cc.run.folded[folded] = outPath
+	return nil
+}
+
+// transformName applies the name transform, if any, to an output path, reporting if the entry is to be generated
+func (cc *CopyCat) transformName(name, outPath string) (string, bool, error) {
+	if cc.nameTransform == nil {
+		return outPath, true, nil
+	}
+
+	rel := cc.nameTransform(cc.relOutPath(outPath))
+	if rel == "" {
+		return "", false, nil
+	}
+	transformed := filepath.Join(cc.run.outRoot, filepath.FromSlash(rel))
+	if !isWithinDir(cc.run.outRoot, transformed) {
+		return "", false, faults.Wrap(&PathEscapeError{Name: name, Path: transformed})
+	}
+	return transformed, true, nil
+}
+
+// removeIfEmpty removes the output directory if it has no entries, reporting if it did
+func (cc *CopyCat) removeIfEmpty(dir string) (bool, error) {
+	subEntries, err := afero.ReadDir(cc.outputFS, dir)
+	if err != nil {
+		return false, faults.Wrap(err)
+	}
+	if len(subEntries) > 0 {
+		return false, nil
+	}
+	if err := cc.outputFS.Remove(dir); err != nil {
+		return false, faults.Wrap(err)
+	}
+	return true, nil
+}
+
+// applyOutputPrefix joins the rendered output prefix, if any, to outPath, creating the resulting directory.
+// It also reports if the directory was created by this call.
+func (cc *CopyCat) applyOutputPrefix(outPath string, dryRun bool) (string, bool, error) {
+	if cc.outputPrefix == "" {
+		return outPath, false, nil
+	}
+
+	prefix, err := cc.renderContent(cc.outputPrefix, cc.model)
+	if err != nil {
+		return "", false, faults.Wrap(err)
+	}
+	prefixed := filepath.Join(outPath, prefix)
+	if !isWithinDir(outPath, prefixed) {
+		return "", false, faults.Wrap(&PathEscapeError{Name: cc.outputPrefix, Path: prefixed})
+	}
+	if dryRun {
+		return prefixed, false, nil
+	}
+
+	exists, err := afero.DirExists(cc.outputFS, prefixed)
+	if err != nil {
+		return "", false, faults.Wrap(err)
+	}
+	if exists {
+		return prefixed, false, nil
+	}
+	if err := cc.outputFS.MkdirAll(prefixed, cc.outputDirMode()); err != nil {
+		return "", false, faults.Wrap(err)
+	}
+	return prefixed, true, nil
+}
+
+// isWithinDir reports whether path is dir or is inside it
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// RunToMap renders the template tree in memory, without touching the output filesystem,
+// and returns the content of the generated files keyed by their path relative to the output root, with forward slashes.
+func (cc *CopyCat) RunToMap(templatePath string) (map[string][]byte, error) {
+	memFS, err := cc.runInMemory(templatePath)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+
+	files := map[string][]byte{}
+	err = afero.Walk(memFS, memRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		data, err := afero.ReadFile(memFS, path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(memRoot, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return files, nil
+}
+
+// memRoot is the output root of the runs in memory
+const memRoot = "out"
+
+// runInMemory runs the template tree into memory, under memRoot, without touching the output filesystem
+func (cc *CopyCat) runInMemory(templatePath string) (afero.Fs, error) {
+	mem := *cc
+	// the cached template functions, and the templates using them, are bound to cc
+	mem.funcs = nil
+	mem.templates = nil
+	mem.outputFS = afero.NewMemMapFs()
+	mem.manifest = false
+	if err := mem.Run(templatePath, memRoot, false); err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return mem.outputFS, nil
+}
+
+// relTemplatePath returns the template path relative to the template root, with forward slashes
+func (cc *CopyCat) relTemplatePath(templatePath string) string {
+	rel, err := filepath.Rel(cc.run.templateRoot, templatePath)
+	if err != nil {
+		return filepath.ToSlash(templatePath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// relOutPath returns the output path relative to the output root, with forward slashes
+func (cc *CopyCat) relOutPath(outPath string) string {
+	rel, err := filepath.Rel(cc.run.outRoot, outPath)
+	if err != nil {
+		return filepath.ToSlash(outPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// processFile renders a template file into the output file name
+func (cc *CopyCat) processFile(templateFile string, name fileName, ctx any, scope renderScope, dryRun bool) error {
+	started := time.Now()
+	outPath := name.path
+	mode := cc.outputFileMode()
+	if name.exec {
+		mode = execFileMode
+	}
+	if cc.renderOnlySuffixed && !name.isTemplate {
+		return cc.copyFile(templateFile, outPath, mode, started, dryRun)
+	}
+
+	data, err := cc.readTemplate(templateFile)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	scope.file = templateFile
+	scope.outputPath = cc.relOutPath(outPath)
+	scope.templatePath = cc.relTemplatePath(templateFile)
+	source := string(data)
+	if cc.collapseBlankLines {
+		source = markActionLines(source)
+	}
+	content, err := cc.renderScoped(source, ctx, scope)
+	if errors.Is(err, errSkipFile) {
+		return cc.skipFile(outPath, dryRun)
+	}
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	content = cc.postProcess(content)
+
+	empty := cc.isEmpty(content) && !cc.keepEmpty(name.isTemplate)
+	if empty {
+		content = ""
+	} else {
+		content, err = cc.addGeneratedHeader(content, ctx, scope)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+	}
+
+	// an empty render clears the marked region of an existing file, which is kept
+	content, merged, err := cc.mergeExisting(outPath, content)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if empty && !merged {
+		// Skip creating empty files
+		return cc.skipFile(outPath, dryRun)
+	}
+
+	content, err = cc.formatOutput(outPath, content)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	if dryRun {
+		cc.reportPlanned(ActionFile, outPath, len(content))
+		return nil
+	}
+	// Write the rendered content to the output file
+	dst, err := cc.openOutput(outPath, mode)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	n, err := dst.WriteString(content)
+	if err != nil {
+		_ = dst.Close()
+		return faults.Wrap(err)
+	}
+	if err := dst.Close(); err != nil {
+		return faults.Wrap(err)
+	}
+	cc.recordGenerated(templateFile, outPath)
+	cc.recordCreatedFile(outPath, int64(n), started)
+	return nil
+}
+
+// readTemplate reads a template file, failing without reading it all when it is larger than the maximum size, if any
+func (cc *CopyCat) readTemplate(path string) ([]byte, error) {
+	if cc.maxFileSize <= 0 {
+		return afero.ReadFile(cc.templateFS, path)
+	}
+
+	f, err := cc.templateFS.Open(path)
 	if err != nil {
 		return nil, faults.Wrap(err)
 	}
-
-	var model map[string]any
-	if err := yaml.Unmarshal(data, &model); err != nil {
-		return nil, faults.Wrap(err)
+	defer f.Close()
+	if info, err := f.Stat(); err == nil && info.Size() > cc.maxFileSize {
+		return nil, faults.Wrap(&FileTooLargeError{Path: path, Limit: cc.maxFileSize})
+	}
+	// the size may be unknown or change while reading
+	data, err := io.ReadAll(io.LimitReader(f, cc.maxFileSize+1))
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	if int64(len(data)) > cc.maxFileSize {
+		return nil, faults.Wrap(&FileTooLargeError{Path: path, Limit: cc.maxFileSize})
+	}
+	return data, nil
+}
+
+// skipFile does not generate an output file, removing the one left by a previous run
+func (cc *CopyCat) skipFile(outPath string, dryRun bool) error {
+	if cc.appending() {
+		// there is nothing to append
+		if dryRun {
+			cc.reportPlanned(ActionSkip, outPath, 0)
+		}
+		return nil
+	}
+	// if the file exists from a previous run, remove it
+	if exists, err := afero.Exists(cc.outputFS, outPath); exists {
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if dryRun {
+			cc.reportPlanned(ActionRemove, outPath, 0)
+			return nil
+		}
+		// Remove the existing file
+		if err = cc.outputFS.Remove(outPath); err != nil {
+			return faults.Wrap(err)
+		}
+		cc.recordRemovedFile(outPath)
+	}
+	if dryRun {
+		cc.reportPlanned(ActionSkip, outPath, 0)
+	}
+	return nil
+}
+
+// copyFile copies a template file verbatim, without rendering it.
+// The content is streamed, so that large files are never fully loaded in memory.
+func (cc *CopyCat) copyFile(templateFile, outPath string, mode os.FileMode, started time.Time, dryRun bool) error {
+	src, err := cc.templateFS.Open(templateFile)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	defer src.Close()
+
+	if dryRun {
+		info, err := src.Stat()
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		cc.reportPlanned(ActionFile, outPath, int(info.Size()))
+		return nil
+	}
+
+	dst, err := cc.openOutput(outPath, mode)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		_ = dst.Close()
+		return faults.Wrap(err)
+	}
+	if err := dst.Close(); err != nil {
+		return faults.Wrap(err)
 	}
-	return model, nil
+	cc.recordGenerated(templateFile, outPath)
+	cc.recordCreatedFile(outPath, n, started)
+	return nil
 }
 
-type CopyCat struct {
-	templateFS  afero.Fs
-	outputFS    afero.Fs
-	model       map[string]any
-	customFuncs template.FuncMap
-}
+// EmptyFiles is the policy applied to files that render to empty content
+type EmptyFiles string
 
-type Option func(*CopyCat)
+const (
+	// EmptyFilesSkip does not create empty files, removing any pre-existing one. This is the default.
+	EmptyFilesSkip EmptyFiles = "skip"
+	// EmptyFilesKeep writes empty files as zero-byte files
+	EmptyFilesKeep EmptyFiles = "keep"
+	// EmptyFilesKeepIfNotTmpl keeps empty files unless their template has a template suffix (.tmpl by default)
+	EmptyFilesKeepIfNotTmpl EmptyFiles = "keep-if-not-tmpl"
+)
 
-func WithCustomFuncs(funcs template.FuncMap) Option {
+// WithEmptyFiles sets the policy for files that render to empty content. Defaults to EmptyFilesSkip.
+func WithEmptyFiles(policy EmptyFiles) Option {
 	return func(cc *CopyCat) {
-		cc.customFuncs = funcs
+		cc.emptyFiles = policy
 	}
 }
 
-func NewCopyCat(templateFS, outputFS afero.Fs, model map[string]any, options ...Option) (*CopyCat, error) {
-	cc := &CopyCat{
-		model:      model,
-		templateFS: templateFS,
-		outputFS:   outputFS,
-	}
-	for _, opt := range options {
-		opt(cc)
+// WithTrimEmptyCheck treats files that render to whitespace only, like "\n  \n", as empty,
+// so that they follow the empty files policy. Files that are written keep their content untouched.
+func WithTrimEmptyCheck() Option {
+	return func(cc *CopyCat) {
+		cc.trimEmptyCheck = true
 	}
+}
 
-	m, err := cc.renderModelValue(model, model)
-	if err != nil {
-		return nil, faults.Wrap(err)
+// isEmpty reports whether rendered content is empty, ignoring whitespace when trimming the empty check
+func (cc *CopyCat) isEmpty(content string) bool {
+	if cc.trimEmptyCheck {
+		return strings.TrimSpace(content) == ""
 	}
-	// if it fails casting, something is very wrong
-	cc.model = m.(map[string]any)
+	return content == ""
+}
 
-	return cc, nil
+// keepEmpty reports whether an empty rendered file should still be written
+func (cc *CopyCat) keepEmpty(isTemplate bool) bool {
+	switch cc.emptyFiles {
+	case EmptyFilesKeep:
+		return true
+	case EmptyFilesKeepIfNotTmpl:
+		return !isTemplate
+	default:
+		return false
+	}
 }
 
-func (cc *CopyCat) renderModelValue(parent, value any) (any, error) {
-	switch v := value.(type) {
-	case string:
-		return cc.renderContent(v, parent)
-	case map[string]any:
-		newMap := make(map[string]any, len(v))
-		for mk, mv := range v {
-			renderedVal, err := cc.renderModelValue(v, mv)
-			if err != nil {
-				return nil, faults.Wrap(err)
-			}
-			newMap[mk] = renderedVal
+// trimTemplateSuffix removes the template suffix from name, reporting whether it had one.
+// Only one trailing suffix is removed, so schema.sql.tmpl becomes schema.sql and a.tmpl.tmpl becomes a.tmpl,
+// and a name that is only the suffix, like .tmpl, is not a template.
+// With template segments, a name without a trailing suffix has its last suffix followed by a dot removed,
+// so notes.tmpl.md becomes notes.md.
+func (cc *CopyCat) trimTemplateSuffix(name string) (string, bool) {
+	suffixes := cc.templateSuffixes
+	if len(suffixes) == 0 {
+		suffixes = []string{defaultTemplateSuffix}
+	}
+	dir, base := filepath.Split(name)
+	for _, suffix := range suffixes {
+		if suffix != "" && base != suffix && strings.HasSuffix(base, suffix) {
+			return dir + strings.TrimSuffix(base, suffix), true
 		}
-		return newMap, nil
-	case []any:
-		newArr := make([]any, len(v))
-		for k, item := range v {
-			renderedItem, err := cc.renderModelValue(v, item)
-			if err != nil {
-				return nil, faults.Wrap(err)
-			}
-			newArr[k] = renderedItem
+	}
+	if !cc.templateSegments {
+		return name, false
+	}
+	for _, suffix := range suffixes {
+		if !strings.HasPrefix(suffix, ".") {
+			continue
+		}
+		if i := strings.LastIndex(base, suffix+"."); i > 0 {
+			return dir + base[:i] + base[i+len(suffix):], true
 		}
-		return newArr, nil
-	default:
-		return v, nil
 	}
+	return name, false
 }
 
-func (cc *CopyCat) Run(templatePath string, outPath string, dryRun bool) error {
-	return cc.processDir(templatePath, outPath, cc.model, dryRun)
+// fileName is an output file name stripped of its template suffix and markers
+type fileName struct {
+	path       string
+	isTemplate bool
+	exec       bool
 }
 
-// ProcessDir processes a template directory and writes output to outFS
-//
-// This function is made public to allow creating other projects to call it directly.
-func (cc *CopyCat) processDir(currentTemplatePath string, currentOutPath string, ctx any, dryRun bool) error {
-	entries, err := afero.ReadDir(cc.templateFS, currentTemplatePath) // Pre-check to ensure templatePath exists
-	if err != nil {
-		return faults.Wrap(err)
+// parseFileName strips the template suffix and the markers from a file name, recording what was found
+func (cc *CopyCat) parseFileName(name string) fileName {
+	var fn fileName
+	name, fn.exec = strings.CutSuffix(name, execMarker)
+	name, keepSuffix := strings.CutSuffix(name, keepSuffixMarker)
+	trimmed, isTemplate := cc.trimTemplateSuffix(name)
+	fn.isTemplate = isTemplate
+	if !keepSuffix {
+		name = trimmed
 	}
+	if !fn.exec {
+		name, fn.exec = strings.CutSuffix(name, execMarker)
+	}
+	fn.path = name
+	return fn
+}
 
-	for _, entry := range entries {
-		expanded, err := expandPath(entry.Name(), ctx)
-		if err != nil {
-			return faults.Wrap(err)
-		}
+// outputFileMode returns the permissions for generated files
+func (cc *CopyCat) outputFileMode() os.FileMode {
+	if cc.fileMode != 0 {
+		return cc.fileMode
+	}
+	return defaultFileMode
+}
 
-		for _, item := range expanded {
-			outPath := filepath.Join(currentOutPath, item.value)
+// outputDirMode returns the permissions for generated directories
+func (cc *CopyCat) outputDirMode() os.FileMode {
+	if cc.dirMode != 0 {
+		return cc.dirMode
+	}
+	return defaultDirMode
+}
 
-			if entry.IsDir() {
-				if dryRun {
-					fmt.Printf("[DIR]  %s\n", outPath)
-				} else {
-					if err := cc.outputFS.MkdirAll(outPath, 0755); err != nil {
-						return faults.Wrap(err)
-					}
-				}
-				err = cc.processDir(filepath.Join(currentTemplatePath, entry.Name()), outPath, item.ctx, dryRun)
-				if err != nil {
-					return faults.Wrap(err)
-				}
+type expandedPath struct {
+	value string
+	ctx   any
+	// frames is the chain of contexts leading to ctx
+	frames []contextFrame
+}
 
-				// After processing the directory, check if it is empty and remove if so
-				// We do this here to avoid removing directories that were not created by copycat
-				if !dryRun {
-					subEntries, err := afero.ReadDir(cc.outputFS, outPath)
-					if err != nil {
-						return faults.Wrap(err)
-					}
-					if len(subEntries) == 0 {
-						if err := cc.outputFS.Remove(outPath); err != nil {
-							return faults.Wrap(err)
-						}
-					}
-				}
+// contextFrame is a context that a path was fanned out to
+type contextFrame struct {
+	// keys is the key path, from the root, of the node holding ctx
+	keys []string
+	ctx  any
+	// index is the position of ctx in elements, the contexts of the fan-out it is one of, if any
+	index    int
+	elements []any
+}
 
-				continue
-			}
+// parentContext returns the context enclosing the current one, if any
+func parentContext(frames []contextFrame) any {
+	if len(frames) < 2 {
+		return nil
+	}
+	return frames[len(frames)-2].ctx
+}
 
-			data, err := afero.ReadFile(cc.templateFS, filepath.Join(currentTemplatePath, entry.Name()))
-			if err != nil {
-				return faults.Wrap(err)
-			}
+// ExpandName returns the names a file or directory name expands to in the given context,
+// following the same rules used for the template tree, e.g. "{{ features.name }}" expands
+// to one name per feature.
+func (cc *CopyCat) ExpandName(name string, ctx any) ([]string, error) {
+	expanded, err := expandPathInFrames(name, []contextFrame{{ctx: ctx}}, cc.strictPaths, cc.fanOutOrder, cc.pipePath)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	names := make([]string, 0, len(expanded))
+	for _, e := range expanded {
+		names = append(names, e.value)
+	}
+	return names, nil
+}
 
-			content, err := cc.renderContent(string(data), item.ctx)
-			if err != nil {
-				return faults.Wrap(err)
-			}
+// expandPath expands placeholders and carries context for each expansion.
+// Array fan-outs are returned in array order, keeping the output deterministic.
+// Placeholders with pipelines are an error, since they need the template functions of a CopyCat.
+func expandPath(path string, ctx any) ([]expandedPath, error) {
+	return expandPathInFrames(path, []contextFrame{{ctx: ctx}}, false, "", nil)
+}
 
-			if content == "" {
-				if dryRun {
-					fmt.Printf("[SKIP] %s (empty after rendering)\n", outPath)
-				}
-				// if the file exists from a previous run, remove it
-				if !dryRun {
-					if exists, err := afero.Exists(cc.outputFS, outPath); exists {
-						if err != nil {
-							return faults.Wrap(err)
-						}
-						// Remove the existing file
-						if err = cc.outputFS.Remove(outPath); err != nil {
-							return faults.Wrap(err)
-						}
-					}
-				}
-				// Skip creating empty files
-				continue
-			}
+// rebindContext makes each of the objects a {{ =key }} placeholder resolved to the context of the candidate,
+// removing the placeholder from the name
+func rebindContext(cand expandedPath, placeholder, path string, values []pathContext, keys []string) ([]expandedPath, error) {
+	var rebound []expandedPath
+	elements := make([]any, len(values))
+	for i, v := range values {
+		elements[i] = v.result
+	}
+	for i, v := range values {
+		if !isObject(v.result) {
+			return nil, faults.Errorf("placeholder %s in %q must resolve to an object, got %T", placeholder, path, v.result)
+		}
+		rebound = append(rebound, expandedPath{
+			value:  strings.ReplaceAll(cand.value, placeholder, ""),
+			ctx:    v.result,
+			frames: append(slices.Clip(cand.frames), contextFrame{keys: keys, ctx: v.result, index: i, elements: elements}),
+		})
+	}
+	return rebound, nil
+}
 
-			outPath = strings.TrimSuffix(outPath, ".tmpl")
-			if dryRun {
-				fmt.Printf("[FILE] %s (%d bytes)\n", outPath, len(content))
-				continue
-			}
-			// Write the rendered content to the output file
-			if err := afero.WriteFile(cc.outputFS, outPath, []byte(content), 0755); err != nil {
-				return faults.Wrap(err)
-			}
+// placeholderPattern matches the placeholders of a path, capturing their key path and pipeline, if any
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^}]+)\s*\}\}`)
+
+// pathPipe applies the pipeline of a placeholder, like `lower | replace "-" "_"`, to the value its key path resolved to
+type pathPipe func(value any, pipeline string) (string, error)
+
+// splitPlaceholder splits the expression of a placeholder into its key path, without a leading dot,
+// and its pipeline, everything after the first | outside of double quotes.
+// A leading = for rebinding is kept in the key path.
+func splitPlaceholder(expr string) (string, string) {
+	quoted := false
+	for i, r := range expr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '|' && !quoted:
+			return trimKeyDot(expr[:i]), strings.TrimSpace(expr[i+1:])
 		}
 	}
-	return nil
+	return trimKeyDot(expr), ""
 }
 
-type expandedPath struct {
-	value string
-	ctx   any
+// trimKeyDot removes the leading dot of a key path, so that {{ .name }} is the same as {{ name }}
+func trimKeyDot(expr string) string {
+	expr = strings.TrimSpace(expr)
+	if rest, rebind := strings.CutPrefix(expr, "="); rebind {
+		return "=" + strings.TrimPrefix(strings.TrimSpace(rest), ".")
+	}
+	return strings.TrimPrefix(expr, ".")
 }
 
-// expandPath expands placeholders and carries context for each expansion
-func expandPath(path string, ctx any) ([]expandedPath, error) {
-	re := regexp.MustCompile(`\{\{\s*([^}]+)\s*\}\}`)
-	matches := re.FindAllStringSubmatch(path, -1)
+// pipePath renders the pipeline of a path placeholder with the template functions, the value being the dot
+func (cc *CopyCat) pipePath(value any, pipeline string) (string, error) {
+	return cc.renderScoped("{{ . | "+pipeline+" }}", value, renderScope{})
+}
+
+// expandPathInFrames expands placeholders against the current context, the last of the frames.
+// When a placeholder cannot be resolved from the current context, it is resolved against the enclosing frames
+// whose key path prefixes it, so that {{ modules.name }}/{{ modules.features.name }} fans out
+// the features of each module instead of the features of all modules.
+//
+// When strict is set, a placeholder that does not resolve to any value is an error, unless it fans out an empty array.
+// When orderBy is set, fan-outs are sorted by that field of the elements.
+// Placeholders can pipe their value through template functions, like {{ features.name | lower }}, applied with pipe.
+func expandPathInFrames(path string, frames []contextFrame, strict bool, orderBy string, pipe pathPipe) ([]expandedPath, error) {
+	matches := placeholderPattern.FindAllStringSubmatch(path, -1)
 
+	ctx := frames[len(frames)-1].ctx
 	if len(matches) == 0 {
 		// No placeholders, return as-is
-		return []expandedPath{{value: path, ctx: ctx}}, nil
+		return []expandedPath{{value: path, ctx: ctx, frames: frames}}, nil
 	}
 
-	candidates := []expandedPath{{value: path, ctx: ctx}}
+	candidates := []expandedPath{{value: path, ctx: ctx, frames: frames}}
 
 	for _, match := range matches {
 		placeholder := match[0]
-		keyPath := strings.Split(match[1], ".")
-		// trim spaces in keyPath elements
-		for i := range keyPath {
-			keyPath[i] = strings.TrimSpace(keyPath[i])
+		expr, pipeline := splitPlaceholder(match[1])
+		expr, rebind := strings.CutPrefix(expr, "=")
+		keyPath := splitKeyPath(expr)
+		if pipeline != "" && (rebind || pipe == nil) {
+			return nil, faults.Errorf("placeholder %s in %q cannot have a pipeline", placeholder, path)
 		}
 
 		var newCandidates []expandedPath
 		for _, cand := range candidates {
-			values := resolveKeyPathWithContext(cand.ctx, cand.ctx, keyPath)
+			values, baseKeys := resolveInFrames(cand.frames, keyPath)
+			if rebind {
+				rebound, err := rebindContext(cand, placeholder, path, values, append(slices.Clone(baseKeys), withoutFilterKeys(keyPath)...))
+				if err != nil {
+					return nil, faults.Wrap(err)
+				}
+				if len(rebound) == 0 && strict {
+					return nil, faults.Errorf("placeholder %s in %q did not resolve to any value", placeholder, path)
+				}
+				newCandidates = append(newCandidates, rebound...)
+				continue
+			}
+			if orderBy != "" {
+				sortByField(values, orderBy)
+			}
 			if len(values) == 0 {
+				if strict && !isEmptyFanOut(cand.frames, keyPath) {
+					return nil, faults.Errorf("placeholder %s in %q did not resolve to any value", placeholder, path)
+				}
 				continue
 			}
 
-			for _, v := range values {
+			elements := make([]any, len(values))
+			for i, v := range values {
+				elements[i] = v.ctx
+			}
+			for i, v := range values {
+				frames := cand.frames
+				if !sameNode(v.ctx, cand.ctx) {
+					// a fan-out switches the context
+					// filters are left out, so that nested placeholders can repeat the path with or without them
+					keys := append(slices.Clone(baseKeys), withoutFilterKeys(keyPath[:len(keyPath)-1])...)
+					frames = append(slices.Clip(frames), contextFrame{keys: keys, ctx: v.ctx, index: i, elements: elements})
+				}
+
 				if isScalar(v.result) {
+					value := fmt.Sprint(v.result)
+					if pipeline != "" {
+						var err error
+						if value, err = pipe(v.result, pipeline); err != nil {
+							return nil, faults.Wrapf(err, "piping placeholder %s in %q", placeholder, path)
+						}
+					}
 					newCandidates = append(newCandidates, expandedPath{
-						value: strings.ReplaceAll(cand.value, placeholder, fmt.Sprint(v.result)),
-						ctx:   v.ctx,
+						value:  strings.ReplaceAll(cand.value, placeholder, value),
+						ctx:    v.ctx,
+						frames: frames,
 					})
 				} else {
+					if pipeline != "" {
+						return nil, faults.Errorf("placeholder %s in %q pipes a %T, which is not a scalar", placeholder, path, v.result)
+					}
 					// if not scalar, context is object/array element
 					newCandidates = append(newCandidates, expandedPath{
-						value: cand.value,
-						ctx:   v.ctx,
+						value:  cand.value,
+						ctx:    v.ctx,
+						frames: frames,
 					})
 				}
 			}
@@ -243,6 +1444,126 @@ func expandPath(path string, ctx any) ([]expandedPath, error) {
 	return candidates, nil
 }
 
+// dirGate is the gate a directory name may start with, like [[if hasDb]]gateway or [[if not hasDb]]memory
+var dirGate = regexp.MustCompile(`^\[\[\s*if\s+(not\s+)?([^\]]+?)\s*\]\]`)
+
+// openGate evaluates the gate of a directory name in the current frames,
+// returning the name without the gate and whether the directory is generated.
+// The gate is open when its key path resolves to a value that is not empty, false or zero.
+func openGate(name string, frames []contextFrame) (string, bool) {
+	match := dirGate.FindStringSubmatch(name)
+	if match == nil {
+		return name, true
+	}
+
+	open := false
+	if values, _ := resolveInFrames(frames, splitKeyPath(match[2])); len(values) > 0 {
+		open, _ = template.IsTrue(values[0].result)
+	}
+	if match[1] != "" {
+		open = !open
+	}
+	return name[len(match[0]):], open
+}
+
+// splitKeyPath splits a placeholder key path on dots, trimming the spaces around the keys.
+// Keys with dots of their own are double quoted, like apps."com.example.app".name.
+func splitKeyPath(expr string) []string {
+	var keys []string
+	var key strings.Builder
+	quoted := false
+	for _, r := range expr {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == '.' && !quoted:
+			keys = append(keys, strings.TrimSpace(key.String()))
+			key.Reset()
+		default:
+			key.WriteRune(r)
+		}
+	}
+	return append(keys, strings.TrimSpace(key.String()))
+}
+
+// resolveInFrames resolves the key path against the current context or, failing that,
+// against the innermost enclosing frame whose key path is a prefix of it.
+// It also returns the key path, from the root, of the context it was resolved against.
+func resolveInFrames(frames []contextFrame, keyPath []string) ([]pathContext, []string) {
+	current := frames[len(frames)-1]
+	if values := resolveKeyPathWithContext(current.ctx, current.ctx, keyPath); len(values) > 0 {
+		return values, current.keys
+	}
+
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		if len(f.keys) == 0 || len(f.keys) >= len(keyPath) || !slices.Equal(f.keys, keyPath[:len(f.keys)]) {
+			continue
+		}
+		if values := resolveKeyPathWithContext(f.ctx, f.ctx, keyPath[len(f.keys):]); len(values) > 0 {
+			return values, f.keys
+		}
+	}
+	return nil, nil
+}
+
+// isEmptyFanOut reports whether the key path goes through an empty array, in the current context
+// or in an enclosing frame whose key path prefixes it.
+func isEmptyFanOut(frames []contextFrame, keyPath []string) bool {
+	if traversesEmptyArray(frames[len(frames)-1].ctx, keyPath) {
+		return true
+	}
+	for _, f := range frames {
+		if len(f.keys) > 0 && len(f.keys) < len(keyPath) && slices.Equal(f.keys, keyPath[:len(f.keys)]) &&
+			traversesEmptyArray(f.ctx, keyPath[len(f.keys):]) {
+			return true
+		}
+	}
+	return false
+}
+
+// traversesEmptyArray reports whether walking the keys from data reaches an empty array
+func traversesEmptyArray(data any, keys []string) bool {
+	switch v := data.(type) {
+	case []any:
+		if len(v) == 0 {
+			return true
+		}
+		for _, item := range v {
+			if traversesEmptyArray(item, keys) {
+				return true
+			}
+		}
+	case map[string]any:
+		if len(keys) == 0 {
+			return false
+		}
+		if field, negate, ok := parseFilterKey(keys[0]); ok {
+			// an element filtered out is like an empty array
+			return !passesFilter(v, field, negate) || traversesEmptyArray(v, keys[1:])
+		}
+		if val, ok := v[keys[0]]; ok {
+			return traversesEmptyArray(val, keys[1:])
+		}
+	default:
+		if items, ok := listItems(v); ok {
+			return traversesEmptyArray(items, keys)
+		}
+		if isObject(v) {
+			if len(keys) == 0 {
+				return false
+			}
+			if field, negate, ok := parseFilterKey(keys[0]); ok {
+				return !passesFilter(v, field, negate) || traversesEmptyArray(v, keys[1:])
+			}
+			if val, ok := objectField(v, keys[0]); ok {
+				return traversesEmptyArray(val, keys[1:])
+			}
+		}
+	}
+	return false
+}
+
 type pathContext struct {
 	result any
 	ctx    any
@@ -257,6 +1578,12 @@ func resolveKeyPathWithContext(parent, data any, keys []string) []pathContext {
 	key := keys[0]
 	switch v := data.(type) {
 	case map[string]any:
+		if field, negate, ok := parseFilterKey(key); ok {
+			if passesFilter(v, field, negate) {
+				return resolveKeyPathWithContext(parent, v, keys[1:])
+			}
+			return nil
+		}
 		if val, ok := v[key]; ok {
 			return resolveKeyPathWithContext(v, val, keys[1:])
 		}
@@ -267,10 +1594,130 @@ func resolveKeyPathWithContext(parent, data any, keys []string) []pathContext {
 			results = append(results, res...)
 		}
 		return results
+	default:
+		// typed models, like structs, pointers and typed slices
+		if items, ok := listItems(v); ok {
+			return resolveKeyPathWithContext(parent, items, keys)
+		}
+		if isObject(v) {
+			if field, negate, ok := parseFilterKey(key); ok {
+				if passesFilter(v, field, negate) {
+					return resolveKeyPathWithContext(parent, v, keys[1:])
+				}
+				return nil
+			}
+			if val, ok := objectField(v, key); ok {
+				return resolveKeyPathWithContext(v, val, keys[1:])
+			}
+		}
 	}
 	return nil
 }
 
+// sortByField sorts the values by a field of their context, stably so that ties keep the array order.
+// Numbers are compared by value and anything else by its text. Values without the field go last.
+func sortByField(values []pathContext, field string) {
+	key := func(v pathContext) (any, bool) {
+		return objectField(v.ctx, field)
+	}
+	slices.SortStableFunc(values, func(a, b pathContext) int {
+		ka, okA := key(a)
+		kb, okB := key(b)
+		if !okA || !okB {
+			// the ones with the field come first
+			return compareBool(okB, okA)
+		}
+		return compareValues(ka, kb)
+	})
+}
+
+// compareValues orders two model values: numbers by value and anything else by its text
+func compareValues(a, b any) int {
+	na, numA := toFloat(a)
+	nb, numB := toFloat(b)
+	if numA && numB {
+		return cmp.Compare(na, nb)
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// compareBool orders false before true
+func compareBool(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case a:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// toFloat converts a model number to float64
+func toFloat(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// parseFilterKey parses a filter key of a key path, like [enabled] or [!enabled] in features.[enabled].name,
+// returning the field it tests and whether the test is negated
+func parseFilterKey(key string) (string, bool, bool) {
+	field, ok := strings.CutPrefix(key, "[")
+	if !ok {
+		return "", false, false
+	}
+	field, ok = strings.CutSuffix(field, "]")
+	if !ok {
+		return "", false, false
+	}
+	field, negate := strings.CutPrefix(strings.TrimSpace(field), "!")
+	return strings.TrimSpace(field), negate, true
+}
+
+// passesFilter reports whether the field of the object is set to a value that is not empty, false or zero,
+// or the opposite when negated
+func passesFilter(obj any, field string, negate bool) bool {
+	val, _ := objectField(obj, field)
+	truth, _ := template.IsTrue(val)
+	return truth != negate
+}
+
+// withoutFilterKeys returns the key path without its filter keys
+func withoutFilterKeys(keyPath []string) []string {
+	return slices.DeleteFunc(slices.Clone(keyPath), func(key string) bool {
+		_, _, ok := parseFilterKey(key)
+		return ok
+	})
+}
+
+// sameNode reports whether a and b are the same model node.
+// Maps and slices are compared by identity.
+func sameNode(a, b any) bool {
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() != vb.Kind() {
+		return false
+	}
+	switch va.Kind() {
+	case reflect.Map, reflect.Slice:
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	case reflect.Invalid:
+		return true
+	}
+	return va.Type() == vb.Type() && va.Type().Comparable() && a == b
+}
+
 func isScalar(v any) bool {
 	switch v.(type) {
 	case string,
@@ -279,25 +1726,165 @@ func isScalar(v any) bool {
 		float32, float64, bool:
 		return true
 	default:
+		// named types of typed models, like type Kind string
+		switch reflect.ValueOf(v).Kind() {
+		case reflect.String, reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			return true
+		}
 		return false
 	}
 }
 
+// maxIncludeDepth limits how deep include calls can nest, guarding against include cycles.
+const maxIncludeDepth = 16
+
+// renderScope carries the information about where a template is being rendered from.
+type renderScope struct {
+	// templateDir is the template FS directory of the file being rendered, used to resolve includes
+	templateDir string
+	// depth is the current include nesting level
+	depth int
+	// parent is the context enclosing the one being rendered
+	parent any
+	// frame is the context being rendered, with its position in the fan-out it comes from
+	frame contextFrame
+	// dirFrame is the context of the directory of the file being rendered, which differs from frame when the file is itself fanned out
+	dirFrame contextFrame
+	// file is the template FS path of the file being rendered, if any, reported on errors
+	file string
+	// outputPath and templatePath are the paths of the generated file and of its template, kept across includes
+	outputPath   string
+	templatePath string
+}
+
+// Render renders a template string with the same functions available to template files:
+// sprig, the copycat helpers and the custom functions.
+// ctx is the dot of the template and root gives access to the model.
+func (cc *CopyCat) Render(content string, ctx any) (string, error) {
+	return cc.renderContent(content, ctx)
+}
+
 // renderContent renders the file content template using Go text/template with sprig.
 // Data model: . is the current context; root is the root model;
 func (cc *CopyCat) renderContent(content string, ctx any) (string, error) {
-	funcs := sprig.TxtFuncMap()
-	// helper funcs to access root/current contexts regardless of dot
-	funcs["root"] = func() any { return cc.model }
-	// apply custom funcs if any
-	maps.Copy(funcs, cc.customFuncs)
-	t, err := template.New("file").Funcs(funcs).Option("missingkey=error").Parse(content)
+	return cc.renderScoped(content, ctx, renderScope{})
+}
+
+func (cc *CopyCat) renderScoped(content string, ctx any, scope renderScope) (string, error) {
+	t, err := cc.parse(content)
 	if err != nil {
-		return "", faults.Wrap(err)
+		return "", faults.Wrap(&TemplateParseError{Path: scope.file, Err: err})
 	}
+
+	// the helpers depending on what is being rendered read it from the current render, restored for nested renders
+	previous := cc.current
+	cc.current = renderState{ctx: ctx, scope: scope}
+	defer func() { cc.current = previous }()
+
 	var buf bytes.Buffer
 	if err := t.Execute(&buf, ctx); err != nil {
-		return "", faults.Wrap(err)
+		return "", faults.Wrap(&TemplateExecuteError{Path: scope.file, Err: err})
 	}
 	return buf.String(), nil
 }
+
+// parse returns the template parsed from content, reusing the one parsed before for the same content,
+// like the files of a directory fanned out over an array
+func (cc *CopyCat) parse(content string) (*template.Template, error) {
+	key := sha256.Sum256([]byte(content))
+	if t, ok := cc.templates[key]; ok {
+		return t, nil
+	}
+
+	t, err := template.New("file").Funcs(cc.funcMap()).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return nil, err
+	}
+	cc.parses++
+	cc.trackTemplate(t)
+	if cc.templates == nil {
+		cc.templates = map[[sha256.Size]byte]*template.Template{}
+	}
+	cc.templates[key] = t
+	return t, nil
+}
+
+// renderState is what is being rendered
+type renderState struct {
+	ctx   any
+	scope renderScope
+}
+
+// funcMap returns the functions available to templates. It is built once, on first use.
+func (cc *CopyCat) funcMap() template.FuncMap {
+	if cc.funcs != nil {
+		return cc.funcs
+	}
+
+	funcs := sprig.TxtFuncMap()
+	// helper funcs to access root/current contexts regardless of dot
+	funcs["root"] = func() any { return cc.model }
+	funcs["parent"] = func() any { return cc.current.scope.parent }
+	funcs["lookup"] = cc.lookup
+	funcs["has"] = cc.has(funcs["has"].(func(any, any) bool))
+	funcs["get"] = cc.get
+	funcs["skip"] = skip
+	funcs["stableID"] = stableID
+	funcs["modelHash"] = cc.modelHash
+	funcs["sortedKeys"] = sortedKeys
+	funcs["uniqSorted"] = uniqSorted
+	funcs["flatten"] = flatten
+	funcs["goExported"] = goExported
+	funcs["goPackage"] = goPackage
+	funcs["goConst"] = goConst
+	funcs["plural"] = plural
+	funcs["singular"] = singular
+	funcs["indentBlock"] = indentBlock
+	funcs["file"] = cc.file
+	funcs["templateFile"] = cc.templateFile
+	funcs["relPath"] = relPath
+	funcs["modulePath"] = cc.modulePath
+	funcs["outputPath"] = func() string { return cc.current.scope.outputPath }
+	funcs["templatePath"] = func() string { return cc.current.scope.templatePath }
+	funcs["index0"] = func() int { return cc.current.scope.frame.index }
+	funcs["index1"] = func() int { return cc.current.scope.frame.index + 1 }
+	funcs["fanOutLen"] = func() int { return len(cc.current.scope.frame.elements) }
+	funcs["dirIndex0"] = func() int { return cc.current.scope.dirFrame.index }
+	funcs["dirIndex1"] = func() int { return cc.current.scope.dirFrame.index + 1 }
+	funcs["siblings"] = cc.siblings
+	funcs["now"] = cc.now
+	funcs["formatDate"] = cc.formatDate
+	funcs["formatNumber"] = formatNumber
+	funcs["envOr"] = cc.envOr
+	funcs["env"] = cc.env
+	funcs["expandenv"] = cc.expandenv
+	funcs["license"] = cc.license
+	funcs["randInt"] = cc.randInt
+	funcs["randAlpha"] = func(n int) string { return cc.randString(n, alphaChars) }
+	funcs["randAlphaNum"] = func(n int) string { return cc.randString(n, alphaChars+numericChars) }
+	funcs["randNumeric"] = func(n int) string { return cc.randString(n, numericChars) }
+	funcs["randAscii"] = func(n int) string { return cc.randString(n, asciiChars) }
+	funcs["randBytes"] = cc.randBytes
+	funcs["uuidv4"] = cc.uuidv4
+	// sprig only has the JSON codecs
+	funcs["fromYaml"] = fromYaml
+	funcs["mustFromYaml"] = mustFromYaml
+	funcs["toYaml"] = toYaml
+	funcs["mustToYaml"] = mustToYaml
+	funcs["include"] = func(name string) (string, error) {
+		return cc.include(name, cc.current.ctx, cc.current.scope)
+	}
+	funcs["tpl"] = func(text string, ctx any) (string, error) {
+		return cc.tpl(text, ctx, cc.current.scope)
+	}
+	// apply provided and custom funcs if any
+	if cc.funcProvider != nil {
+		maps.Copy(funcs, cc.funcProvider.funcs())
+	}
+	maps.Copy(funcs, cc.customFuncs)
+	cc.funcs = funcs
+	return funcs
+}
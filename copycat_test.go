@@ -1,11 +1,17 @@
 package copycat
 
 import (
+	"bytes"
+	"embed"
+	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -147,6 +153,20 @@ func TestExpandPathScalar(t *testing.T) {
 	assert.Equal(t, "TestProject", segments[0].value, "expanded path should match")
 }
 
+func TestExpandPathQuotedKeys(t *testing.T) {
+	model := map[string]any{
+		"com.example.app": "app",
+		"apps": map[string]any{
+			"com.example.api": map[string]any{"name": "api"},
+		},
+	}
+
+	segments, err := expandPath(`{{ "com.example.app" }}-{{ apps."com.example.api".name }}`, model)
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	assert.Equal(t, "app-api", segments[0].value)
+}
+
 func TestExpandPathSegmentArray(t *testing.T) {
 	model := map[string]any{
 		"features": []any{
@@ -274,6 +294,137 @@ func TestCompleteTemplateExpansion(t *testing.T) {
 	assert.Contains(t, content, "package gateway", "db.go should contain package declaration")
 }
 
+func TestFilteredFanOut(t *testing.T) {
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "authentication", "enabled": true},
+			map[string]any{"name": "billing", "enabled": false},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.[enabled].name }}/{{ features.name }}.go.tmpl", []byte("package {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/disabled/{{ features.[!enabled].name }}.txt", []byte("off\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithStrictPaths())
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"authentication/authentication.go", "disabled/billing.txt"}, slices.Sorted(maps.Keys(files)))
+
+	// filtering out every element is an empty fan-out, even with strict paths
+	model["features"] = []any{map[string]any{"name": "billing", "enabled": false}}
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model, WithStrictPaths())
+	require.NoError(t, err)
+	files, err = cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"disabled/billing.txt"}, slices.Sorted(maps.Keys(files)))
+}
+
+func TestFileFanOut(t *testing.T) {
+	model := map[string]any{
+		"projectName": "shop",
+		"features": []any{
+			map[string]any{"name": "auth", "table": "users"},
+			map[string]any{"name": "billing", "table": "invoices"},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	template := "-- {{ (root).projectName }}/{{ .name }}\nCREATE TABLE {{ .table }} (id INT);\n"
+	require.NoError(t, afero.WriteFile(inFS, "template/migrations/{{ features.name }}.sql.tmpl", []byte(template), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"migrations/auth.sql":    []byte("-- shop/auth\nCREATE TABLE users (id INT);\n"),
+		"migrations/billing.sql": []byte("-- shop/billing\nCREATE TABLE invoices (id INT);\n"),
+	}, files)
+}
+
+func TestFanOutIndex(t *testing.T) {
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "auth"},
+			map[string]any{"name": "billing"},
+			map[string]any{"name": "search"},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}.txt.tmpl", []byte("{{ .name }} {{ index0 }} {{ index1 }}/{{ fanOutLen }}\n"), 0o644))
+	// files of a fanned out directory, and their includes, get the position of the directory
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/const.go.tmpl", []byte(`const {{ .name | upper }} = {{ include "snippet.txt" }}`), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/snippet.txt", []byte("{{ index0 }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md.tmpl", []byte("{{ index0 }} {{ fanOutLen }}\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, "auth 0 1/3\n", string(files["auth.txt"]))
+	assert.Equal(t, "billing 1 2/3\n", string(files["billing.txt"]))
+	assert.Equal(t, "search 2 3/3\n", string(files["search.txt"]))
+	assert.Equal(t, "const BILLING = 1\n", string(files["billing/const.go"]))
+	assert.Equal(t, "const SEARCH = 2\n", string(files["search/const.go"]))
+	// outside of a fan-out
+	assert.Equal(t, "0 0\n", string(files["README.md"]))
+}
+
+func TestFanOutDirIndex(t *testing.T) {
+	model := map[string]any{
+		"modules": []any{
+			map[string]any{"name": "core", "features": []any{map[string]any{"name": "auth"}}},
+			map[string]any{"name": "shop", "features": []any{map[string]any{"name": "cart"}, map[string]any{"name": "orders"}}},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	// a fanned out file gets its own position, and the position of its directory with dirIndex0 and dirIndex1
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ modules.name }}/{{ features.name }}.sql.tmpl", []byte(`{{ printf "%03d_%02d" dirIndex1 index1 }}_{{ .name }} {{ include "snippet.txt" }}`), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ modules.name }}/snippet.txt", []byte("{{ dirIndex0 }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ modules.name }}/module.txt.tmpl", []byte("{{ .name }} {{ index0 }} {{ dirIndex0 }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md.tmpl", []byte("{{ dirIndex0 }} {{ dirIndex1 }}\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, "001_01_auth 0\n", string(files["core/auth.sql"]))
+	assert.Equal(t, "002_01_cart 1\n", string(files["shop/cart.sql"]))
+	assert.Equal(t, "002_02_orders 1\n", string(files["shop/orders.sql"]))
+	// the directory position, the same as index0 for files that are not fanned out themselves
+	assert.Equal(t, "core 0 0\n", string(files["core/module.txt"]))
+	assert.Equal(t, "shop 1 1\n", string(files["shop/module.txt"]))
+	// outside of a fan-out
+	assert.Equal(t, "0 1\n", string(files["README.md"]))
+}
+
+func TestSiblings(t *testing.T) {
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "auth"},
+			map[string]any{"name": "billing"},
+			map[string]any{"name": "search"},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/deps.txt.tmpl", []byte("{{ .name }}:{{ range siblings }} {{ .name }}{{ end }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md.tmpl", []byte("{{ len siblings }}\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, "auth: billing search\n", string(files["auth/deps.txt"]))
+	assert.Equal(t, "billing: auth search\n", string(files["billing/deps.txt"]))
+	assert.Equal(t, "search: auth billing\n", string(files["search/deps.txt"]))
+	// outside of a fan-out
+	assert.Equal(t, "0\n", string(files["README.md"]))
+}
+
 func TestEmptyArrayHandling(t *testing.T) {
 	model := map[string]any{
 		"projectName": "EmptyTest",
@@ -437,10 +588,993 @@ func TestCustomFuncsAndRenderModel(t *testing.T) {
 		model:       model,
 		customFuncs: customFuncs,
 	}
-	m, err := cc.renderModelValue(model, model)
+	m, err := cc.renderModelValue("", model, model)
 	require.NoError(t, err, "renderModel should not fail")
 	model = m.(map[string]any)
 
 	assert.Equal(t, "My App", model["projectName"], "projectName should remain unchanged")
 	assert.Equal(t, "my_app", model["projectSlug"], "projectSlug should be rendered correctly")
 }
+
+// recordingFs records the order in which files are written
+type recordingFs struct {
+	afero.Fs
+	written []string
+}
+
+func (r *recordingFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if flag&os.O_CREATE != 0 {
+		r.written = append(r.written, name)
+	}
+	return r.Fs.OpenFile(name, flag, perm)
+}
+
+func TestDeterministicOutput(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	run := func() (*recordingFs, map[string]string) {
+		outFS := &recordingFs{Fs: afero.NewMemMapFs()}
+		cc, err := NewCopyCat(afero.NewOsFs(), outFS, model, WithCustomFuncs(customFuncs))
+		require.NoError(t, err)
+		err = cc.Run("examples/template", "", false)
+		require.NoError(t, err)
+
+		files := map[string]string{}
+		err = afero.Walk(outFS, "my_app", func(path string, info fs.FileInfo, err error) error {
+			require.NoError(t, err)
+			if !info.IsDir() {
+				data, err := afero.ReadFile(outFS, path)
+				require.NoError(t, err)
+				files[path] = string(data)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		return outFS, files
+	}
+
+	first, firstFiles := run()
+	second, secondFiles := run()
+
+	assert.Equal(t, firstFiles, secondFiles, "generated files should be byte-identical across runs")
+	assert.Equal(t, []string{
+		"my_app/README.md",
+		"my_app/auth/config.txt",
+		"my_app/auth/auth.go",
+		"my_app/payments/config.txt",
+		"my_app/payments/payments.go",
+	}, first.written, "files are processed by template name, in array order")
+	assert.Equal(t, first.written, second.written, "files should be written in the same order across runs")
+}
+
+func TestFileAndDirMode(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(
+		afero.NewOsFs(),
+		outFS,
+		model,
+		WithCustomFuncs(customFuncs),
+		WithFileMode(0o600),
+		WithDirMode(0o700),
+	)
+	require.NoError(t, err)
+
+	err = cc.Run("examples/template", "", false)
+	require.NoError(t, err)
+
+	info, err := outFS.Stat("my_app/auth/auth.go")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	info, err = outFS.Stat("my_app/auth")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+}
+
+func TestExecMarker(t *testing.T) {
+	templateFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(templateFS, "template/deploy.sh@exec", []byte("#!/bin/sh\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/run-{{ name }}.sh@exec.tmpl", []byte("#!/bin/sh\necho {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/README.md", []byte("readme\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(templateFS, outFS, map[string]any{"name": "app"}, WithFileMode(0o600))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	for _, name := range []string{"out/deploy.sh", "out/run-app.sh"} {
+		info, err := outFS.Stat(name)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), name)
+	}
+
+	info, err := outFS.Stat("out/README.md")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+func TestFileModeOnRegeneration(t *testing.T) {
+	templateFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(templateFS, "template/run.sh@exec", []byte("#!/bin/sh\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/README.md.tmpl", []byte("{{ .name }}\n"), 0o644))
+
+	// left by a previous run with other permissions
+	outDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "run.sh"), []byte("old\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(outDir, "README.md"), []byte("old\n"), 0o644))
+
+	cc, err := NewCopyCat(templateFS, afero.NewOsFs(), map[string]any{"name": "app"}, WithFileMode(0o600))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", outDir, false))
+
+	for name, mode := range map[string]os.FileMode{"run.sh": 0o755, "README.md": 0o600} {
+		info, err := os.Stat(filepath.Join(outDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), name)
+	}
+}
+
+func TestEmptyFilesPolicy(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/.gitkeep", []byte(""), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/db.go.tmpl", []byte("{{ if .hasDb }}package db{{ end }}"), 0o644)
+	require.NoError(t, err)
+
+	tests := []struct {
+		policy   EmptyFiles
+		expected map[string]bool
+	}{
+		{policy: EmptyFilesSkip, expected: map[string]bool{"out/.gitkeep": false, "out/db.go": false}},
+		{policy: EmptyFilesKeep, expected: map[string]bool{"out/.gitkeep": true, "out/db.go": true}},
+		{policy: EmptyFilesKeepIfNotTmpl, expected: map[string]bool{"out/.gitkeep": true, "out/db.go": false}},
+	}
+
+	for _, tt := range tests {
+		outFS := afero.NewMemMapFs()
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{"hasDb": false}, WithEmptyFiles(tt.policy))
+		require.NoError(t, err)
+
+		err = cc.Run("template", "out", false)
+		require.NoError(t, err)
+
+		for path, exists := range tt.expected {
+			info, err := outFS.Stat(path)
+			if !exists {
+				assert.True(t, os.IsNotExist(err), "policy %s: %s should not exist", tt.policy, path)
+				continue
+			}
+			require.NoError(t, err, "policy %s: %s should exist", tt.policy, path)
+			assert.Zero(t, info.Size(), "policy %s: %s should be empty", tt.policy, path)
+		}
+	}
+}
+
+func TestTrimEmptyCheck(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/db.go.tmpl", []byte("{{ if .hasDb }}package db{{ end }}\n  \n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/main.go.tmpl", []byte("\npackage main\n  \n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	// a previous run generated db.go
+	require.NoError(t, afero.WriteFile(outFS, "out/db.go", []byte("package db\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"hasDb": false}, WithTrimEmptyCheck())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	_, err = outFS.Stat("out/db.go")
+	assert.True(t, os.IsNotExist(err), "whitespace only render should be treated as empty")
+
+	// non empty content is written as rendered
+	data, err := afero.ReadFile(outFS, "out/main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "\npackage main\n  \n", string(data))
+
+	// without the option, whitespace is content
+	outFS = afero.NewMemMapFs()
+	cc, err = NewCopyCat(inFS, outFS, map[string]any{"hasDb": false})
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+	data, err = afero.ReadFile(outFS, "out/db.go")
+	require.NoError(t, err)
+	assert.Equal(t, "\n  \n", string(data))
+}
+
+func TestSkipFile(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/feature.txt.tmpl", []byte("{{ if not .enabled }}{{ skip }}{{ end }}feature {{ .name }}\n"), 0o644))
+	// a legitimately empty file is kept
+	require.NoError(t, afero.WriteFile(inFS, "template/__init__.py.tmpl", []byte("{{ if false }}x{{ end }}"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	// a previous run generated feature.txt
+	require.NoError(t, afero.WriteFile(outFS, "out/feature.txt", []byte("feature auth\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "auth", "enabled": false}, WithEmptyFiles(EmptyFilesKeep))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	_, err = outFS.Stat("out/feature.txt")
+	assert.True(t, os.IsNotExist(err), "skipped file should be removed")
+	assert.Equal(t, []string{"feature.txt"}, cc.Result().RemovedFiles)
+	data, err := afero.ReadFile(outFS, "out/__init__.py")
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	cc, err = NewCopyCat(inFS, outFS, map[string]any{"name": "auth", "enabled": true})
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+	data, err = afero.ReadFile(outFS, "out/feature.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "feature auth\n", string(data))
+}
+
+func TestEmptyRenderRemovesPreviousTrimmedOutput(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/db.go.tmpl", []byte("{{ if .hasDb }}package db{{ end }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(outFS, "out/db.go", []byte("package db"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"hasDb": false})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	_, err = outFS.Stat("out/db.go")
+	assert.True(t, os.IsNotExist(err), "previously generated file should be removed")
+}
+
+func TestKeepMarkerPreservesEmptyDirectory(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, filepath.Join("template", "{{ projectName }}", "internal", keepMarker), []byte(""), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, filepath.Join("template", "{{ projectName }}", "README.md"), []byte("# {{ .projectName }}"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"projectName": "TestProject"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "output", false)
+	require.NoError(t, err)
+
+	info, err := outFS.Stat(filepath.Join("output", "TestProject", "internal"))
+	require.NoError(t, err, "directory with keep marker should survive")
+	assert.True(t, info.IsDir())
+
+	entries, err := afero.ReadDir(outFS, filepath.Join("output", "TestProject", "internal"))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "keep marker should not be copied")
+}
+
+func TestWithModelRendering(t *testing.T) {
+	model := map[string]any{
+		"projectName": "My App",
+		"snippet":     "{{ not_a_key }}",
+	}
+
+	_, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.Error(t, err, "rendering the model should fail on the literal template")
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model, WithModelRendering(false))
+	require.NoError(t, err)
+	assert.Equal(t, "{{ not_a_key }}", cc.model["snippet"], "literal value should survive verbatim")
+}
+
+func TestNestedArrayFanOut(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/{{ modules.name }}/{{ modules.features.name }}/info.txt", []byte("{{ parent.name }}/{{ .name }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"modules": []any{
+			map[string]any{
+				"name": "core",
+				"features": []any{
+					map[string]any{"name": "auth"},
+					map[string]any{"name": "users"},
+				},
+			},
+			map[string]any{
+				"name": "shop",
+				"features": []any{
+					map[string]any{"name": "cart"},
+					map[string]any{"name": "orders"},
+				},
+			},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	expected := []string{"core/auth", "core/users", "shop/cart", "shop/orders"}
+	var dirs []string
+	for _, module := range []string{"core", "shop"} {
+		entries, err := afero.ReadDir(outFS, filepath.Join("out", module))
+		require.NoError(t, err)
+		for _, e := range entries {
+			dirs = append(dirs, module+"/"+e.Name())
+		}
+	}
+	assert.Equal(t, expected, dirs, "each module should only fan out its own features")
+
+	for _, dir := range expected {
+		data, err := afero.ReadFile(outFS, filepath.Join("out", dir, "info.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, dir, string(data), "file should carry both module and feature context")
+	}
+}
+
+func TestTemplateSuffix(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/main.go.gotmpl", []byte("package {{ .name }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/view.html.tpl", []byte("<h1>{{ .name }}</h1>"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/notes.txt.tmpl", []byte("{{ .name }}"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "app"}, WithTemplateSuffix(".gotmpl", ".tpl"))
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"out/main.go":        "package app",
+		"out/view.html":      "<h1>app</h1>",
+		"out/notes.txt.tmpl": "app", // not a configured suffix, so it is rendered but keeps its name
+	}
+	for path, content := range expected {
+		data, err := afero.ReadFile(outFS, path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+}
+
+func TestTemplateSuffixTrimming(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	for _, name := range []string{"schema.sql.tmpl", "plain.tmpl", "notes.tmpl.md", "nested.tmpl.tmpl", ".tmpl", "gitignore.tmpl@keep", "run.sh.tmpl@keep@exec", "doc.tmpl.md@keep"} {
+		require.NoError(t, afero.WriteFile(inFS, "template/"+name, []byte("{{ .name }}"), 0o644))
+	}
+
+	tests := []struct {
+		name     string
+		options  []Option
+		expected map[string]string
+	}{
+		{
+			name: "trailing suffix only",
+			expected: map[string]string{
+				"out/schema.sql":     "app",
+				"out/plain":          "app",
+				"out/notes.tmpl.md":  "app",
+				"out/nested.tmpl":    "app",
+				"out/.tmpl":          "app", // the whole name is not a suffix
+				"out/gitignore.tmpl": "app", // marked to keep the suffix
+				"out/run.sh.tmpl":    "app",
+				"out/doc.tmpl.md":    "app",
+			},
+		},
+		{
+			name:    "template segments",
+			options: []Option{WithTemplateSegments()},
+			expected: map[string]string{
+				"out/schema.sql":     "app",
+				"out/plain":          "app",
+				"out/notes.md":       "app",
+				"out/nested.tmpl":    "app", // exactly one segment is removed, the trailing one first
+				"out/.tmpl":          "app",
+				"out/gitignore.tmpl": "app",
+				"out/run.sh.tmpl":    "app",
+				"out/doc.tmpl.md":    "app",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outFS := afero.NewMemMapFs()
+			cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "app"}, tt.options...)
+			require.NoError(t, err)
+			require.NoError(t, cc.Run("template", "out", false))
+
+			files := map[string]string{}
+			err = afero.Walk(outFS, "out", func(path string, info fs.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				data, err := afero.ReadFile(outFS, path)
+				files[filepath.ToSlash(path)] = string(data)
+				return err
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, files)
+		})
+	}
+}
+
+func TestRenderOnlySuffixed(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	static := `{"name": "{{ .name }}"}`
+	err := afero.WriteFile(inFS, "template/static.json", []byte(static), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/config.json.tmpl", []byte(`{"name": "{{ .name }}"}`), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/.gitkeep", []byte(""), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "app"}, WithRenderOnlySuffixed())
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/static.json")
+	require.NoError(t, err)
+	assert.Equal(t, static, string(data), "static file should be copied verbatim")
+
+	data, err = afero.ReadFile(outFS, "out/config.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"name": "app"}`, string(data), "template should be rendered")
+
+	_, err = outFS.Stat("out/.gitkeep")
+	assert.NoError(t, err, "empty static file should be copied")
+}
+
+// chunkFs records the largest chunk read from its files
+type chunkFs struct {
+	afero.Fs
+	largest int
+}
+
+func (c *chunkFs) Open(name string) (afero.File, error) {
+	f, err := c.Fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &chunkFile{File: f, fs: c}, nil
+}
+
+type chunkFile struct {
+	afero.File
+	fs *chunkFs
+}
+
+func (f *chunkFile) Read(b []byte) (int, error) {
+	n, err := f.File.Read(b)
+	f.fs.largest = max(f.fs.largest, n)
+	return n, err
+}
+
+func TestVerbatimCopyIsStreamed(t *testing.T) {
+	large := bytes.Repeat([]byte("0123456789abcdef{{ }}\n"), 256*1024) // 6MB
+	inFS := &chunkFs{Fs: afero.NewMemMapFs()}
+	require.NoError(t, afero.WriteFile(inFS, "template/data.bin", large, 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{}, WithRenderOnlySuffixed())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/data.bin")
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(large, data), "file should be copied verbatim")
+	assert.Less(t, inFS.largest, len(large)/10, "file should be read in chunks")
+}
+
+func TestStrictPaths(t *testing.T) {
+	model := map[string]any{
+		"projectName": "App",
+		"features":    []any{},
+	}
+
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/{{ projetName }}/README.md", []byte("readme"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithStrictPaths())
+	require.NoError(t, err)
+	err = cc.Run("template", "out", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "{{ projetName }}")
+
+	// without strict mode the entry is silently dropped
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	// empty arrays still fan out to nothing
+	segments, err := expandPathInFrames("{{ features.name }}", []contextFrame{{ctx: model}}, true, "", nil)
+	require.NoError(t, err)
+	assert.Empty(t, segments)
+}
+
+func TestPathPipelines(t *testing.T) {
+	model := map[string]any{
+		"groups": []any{
+			map[string]any{"name": "Billing", "services": []any{
+				map[string]any{"name": "InvoiceSender"},
+				map[string]any{"name": "PaymentGateway"},
+			}},
+			map[string]any{"name": "Identity", "services": []any{
+				map[string]any{"name": "UserStore"},
+			}},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, `template/{{ groups.name | lower }}/{{ services.name | goConst | lower }}/{{ .name | goPackage | printf "%s_impl" }}.go.tmpl`, []byte("package {{ .name | goPackage }}\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string][]byte{
+		"billing/invoice_sender/invoicesender_impl.go":   []byte("package invoicesender\n"),
+		"billing/payment_gateway/paymentgateway_impl.go": []byte("package paymentgateway\n"),
+		"identity/user_store/userstore_impl.go":          []byte("package userstore\n"),
+	}, files)
+
+	// pipelines only apply to scalars, with known functions
+	for name, msg := range map[string]string{
+		"template/{{ groups | lower }}.txt":       "which is not a scalar",
+		"template/{{ groups.name | nope }}.txt":   `function "nope" not defined`,
+		"template/{{ =groups | lower }}/file.txt": "cannot have a pipeline",
+	} {
+		inFS := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(inFS, name, []byte("x"), 0o644))
+		cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+		require.NoError(t, err)
+		_, err = cc.RunToMap("template")
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), msg, name)
+	}
+}
+
+func TestPathTraversalGuard(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/{{ features.name }}/evil.txt", []byte("pwned"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "../../etc"},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out/app", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "path escapes output directory")
+
+	_, err = outFS.Stat("etc/evil.txt")
+	assert.True(t, os.IsNotExist(err), "nothing should be written outside the output directory")
+
+	// nested paths that stay inside the output directory are fine
+	model = map[string]any{
+		"features": []any{
+			map[string]any{"name": "a/../b"},
+		},
+	}
+	cc, err = NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out/app", false))
+	_, err = outFS.Stat("out/app/b/evil.txt")
+	assert.NoError(t, err)
+}
+
+func TestRender(t *testing.T) {
+	model := map[string]any{
+		"projectName": "My App",
+	}
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	rendered, err := cc.Render(`{{ .name | slugify }} of {{ root.projectName | upper }}`, map[string]any{"name": "Auth Feature"})
+	require.NoError(t, err)
+	assert.Equal(t, "auth_feature of MY APP", rendered)
+}
+
+func TestExpandName(t *testing.T) {
+	model := map[string]any{
+		"projectName": "App",
+		"features": []any{
+			map[string]any{"name": "users"},
+			map[string]any{"name": "orders"},
+		},
+	}
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+
+	names, err := cc.ExpandName("{{ features.name }}", model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "orders"}, names)
+
+	names, err = cc.ExpandName("{{ projectName }}-{{ features.name }}.go", model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"App-users.go", "App-orders.go"}, names)
+}
+
+func TestOutputPrefix(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outFS := afero.NewMemMapFs()
+	// pre-existing content next to the prefix must be preserved
+	err = afero.WriteFile(outFS, "out/services/existing.txt", []byte("keep me"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(
+		afero.NewOsFs(),
+		outFS,
+		model,
+		WithCustomFuncs(customFuncs),
+		WithOutputPrefix("services/{{ .projectSlug }}-svc"),
+	)
+	require.NoError(t, err)
+
+	err = cc.Run("examples/template", "out", false)
+	require.NoError(t, err)
+
+	err = afero.Walk(outFS, "out", func(path string, info fs.FileInfo, err error) error {
+		require.NoError(t, err)
+		if !info.IsDir() && path != "out/services/existing.txt" {
+			assert.True(t, strings.HasPrefix(path, "out/services/my_app-svc/"), "file %s should be under the prefix", path)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	_, err = outFS.Stat("out/services/my_app-svc/my_app/auth/auth.go")
+	assert.NoError(t, err)
+	_, err = outFS.Stat("out/services/existing.txt")
+	assert.NoError(t, err)
+}
+
+func TestOutputPrefixRemovedWhenEmpty(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/empty.txt", []byte(""), 0o644)
+	require.NoError(t, err)
+	err = outFS.MkdirAll("out", 0o755)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{}, WithOutputPrefix("generated"))
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	_, err = outFS.Stat("out/generated")
+	assert.True(t, os.IsNotExist(err), "empty prefix directory created by copycat should be removed")
+	_, err = outFS.Stat("out")
+	assert.NoError(t, err, "pre-existing output directory should remain")
+}
+
+func TestRunToMap(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(afero.NewOsFs(), outFS, model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	files, err := cc.RunToMap("examples/template")
+	require.NoError(t, err)
+
+	keys := slices.Sorted(maps.Keys(files))
+	assert.Equal(t, []string{
+		"my_app/README.md",
+		"my_app/auth/auth.go",
+		"my_app/auth/config.txt",
+		"my_app/payments/config.txt",
+		"my_app/payments/payments.go",
+	}, keys)
+	assert.Contains(t, string(files["my_app/auth/auth.go"]), "package auth")
+	assert.Contains(t, string(files["my_app/payments/config.txt"]), "Feature: payments")
+
+	// nothing is written to the output filesystem
+	entries, err := afero.ReadDir(outFS, "/")
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+//go:embed testdata/embedded
+var embeddedTemplates embed.FS
+
+func TestNewCopyCatFromFS(t *testing.T) {
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCatFromFS(embeddedTemplates, "testdata/embedded/template/", outFS, map[string]any{"name": "world"})
+	require.NoError(t, err)
+
+	err = cc.Run(".", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/world/hello.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world\n", string(data))
+
+	exists, err := afero.Exists(outFS, "out/README.md")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = afero.DirExists(outFS, "out/testdata")
+	require.NoError(t, err)
+	assert.False(t, exists, "the output should not have the root prefix")
+}
+
+func TestNameTransform(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ name }}/{{ name }}Service.go.tmpl", []byte("package {{ .name | lower }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/Docs/README.md", []byte("docs\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/Docs/internal.md", []byte("internal\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "Billing"}, WithNameTransform(func(path string) string {
+		if path == "docs/internal.md" {
+			return ""
+		}
+		return strings.ToLower(path)
+	}))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	var files []string
+	err = afero.Walk(outFS, "out", func(path string, info fs.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, filepath.ToSlash(path))
+		}
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"out/billing/billingservice.go", "out/docs/readme.md"}, files)
+}
+
+func TestGatedDirectories(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/[[if hasDb]]gateway/{{ name }}Repository.go.tmpl", []byte("package gateway\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/[[if not hasDb]]memory/store.go", []byte("package memory\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/main.go", []byte("package main\n"), 0o644))
+
+	tests := []struct {
+		hasDb    bool
+		expected []string
+	}{
+		{hasDb: true, expected: []string{"out/gateway/billingRepository.go", "out/main.go"}},
+		{hasDb: false, expected: []string{"out/main.go", "out/memory/store.go"}},
+	}
+	for _, tt := range tests {
+		outFS := afero.NewMemMapFs()
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "billing", "hasDb": tt.hasDb})
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false))
+
+		var files []string
+		err = afero.Walk(outFS, "out", func(path string, info fs.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				files = append(files, filepath.ToSlash(path))
+			}
+			return err
+		})
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, files)
+
+		// a closed gate never creates its directory
+		for _, dir := range cc.Result().CreatedDirs {
+			assert.NotContains(t, dir, "[[")
+		}
+		exists, err := afero.DirExists(outFS, "out/gateway")
+		require.NoError(t, err)
+		assert.Equal(t, tt.hasDb, exists)
+	}
+}
+
+func TestContextRebinding(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ =owner }}/owner.txt.tmpl", []byte("{{ .name }} <{{ .email }}> for {{ (root).name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ =owner }}contact/{{ name }}.txt.tmpl", []byte("{{ .email }}\n"), 0o644))
+
+	model := map[string]any{
+		"name":  "billing",
+		"owner": map[string]any{"name": "Acme", "email": "dev@acme.com"},
+	}
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"owner.txt":        []byte("Acme <dev@acme.com> for billing\n"),
+		"contact/Acme.txt": []byte("dev@acme.com\n"),
+	}, files)
+
+	// only objects can be the context
+	_, err = cc.ExpandName("{{ =name }}", model)
+	require.Error(t, err)
+}
+
+func TestDynamicExtension(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := `{{ if eq .format "json" }}{"name": "{{ .name }}"}{{ else }}name: {{ .name }}{{ end }}
+`
+	require.NoError(t, afero.WriteFile(inFS, "template/config.{{ format }}.tmpl", []byte(template), 0o644))
+
+	tests := []struct {
+		format   string
+		file     string
+		expected string
+	}{
+		{format: "yaml", file: "out/config.yaml", expected: "name: api\n"},
+		{format: "json", file: "out/config.json", expected: "{\"name\": \"api\"}\n"},
+	}
+	for _, tt := range tests {
+		outFS := afero.NewMemMapFs()
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "api", "format": tt.format})
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false))
+
+		entries, err := afero.ReadDir(outFS, "out")
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		data, err := afero.ReadFile(outFS, tt.file)
+		require.NoError(t, err, tt.format)
+		assert.Equal(t, tt.expected, string(data))
+	}
+}
+
+func TestFuncMapProvider(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	calls := 0
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewMemMapFs(), model, WithFuncMapProvider(func() template.FuncMap {
+		calls++
+		return customFuncs
+	}))
+	require.NoError(t, err)
+
+	require.NoError(t, cc.Run("examples/template", "", false))
+	_, err = cc.RunToMap("examples/template")
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls, "the provider should run once")
+}
+
+func BenchmarkRun(b *testing.B) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(b, err, "failed to load model")
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewMemMapFs(), model, WithCustomFuncs(customFuncs))
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := cc.Run("examples/template", "", false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// wideFanOut returns a template tree fanned out over a model with n features
+func wideFanOut(n int) (afero.Fs, map[string]any) {
+	inFS := afero.NewMemMapFs()
+	_ = afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte("package {{ .name }}\n\nconst Table = \"{{ .table }}\"\n"), 0o644)
+	_ = afero.WriteFile(inFS, "template/{{ features.name }}/config.txt", []byte("Feature: {{ .name }}\nProject: {{ root.projectName }}\n"), 0o644)
+
+	features := make([]any, n)
+	for i := range features {
+		features[i] = map[string]any{"name": fmt.Sprintf("feature%d", i), "table": fmt.Sprintf("table%d", i)}
+	}
+	return inFS, map[string]any{"projectName": "Wide", "features": features}
+}
+
+func TestParsedTemplatesCache(t *testing.T) {
+	inFS, model := wideFanOut(50)
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	require.NoError(t, cc.Run("template", "out", false))
+	data, err := afero.ReadFile(outFS, "out/feature42/feature42.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package feature42\n\nconst Table = \"table42\"\n", string(data))
+	assert.Equal(t, 2, cc.parses, "each template should be parsed once")
+
+	require.NoError(t, cc.Run("template", "out", false))
+	assert.Equal(t, 2, cc.parses, "templates should be reused across runs")
+}
+
+func BenchmarkWideFanOut(b *testing.B) {
+	inFS, model := wideFanOut(200)
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(b, err)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := cc.Run("template", "out", false); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(cc.parses)/float64(b.N), "parses/op")
+}
+
+func TestNewFromDir(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outDir := filepath.Join(t.TempDir(), "generated")
+	cc, err := NewFromDir("examples/template", outDir, model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+	require.NoError(t, cc.Generate(false))
+
+	data, err := os.ReadFile(filepath.Join(outDir, "my_app", "auth", "auth.go"))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "package auth")
+	_, err = os.Stat(filepath.Join(outDir, "my_app", "README.md"))
+	require.NoError(t, err)
+}
+
+func TestNewFromDirWorkingDirectory(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tpl"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tpl", "a.txt.tmpl"), []byte("{{ .name }}\n"), 0o644))
+	t.Chdir(dir)
+
+	// into the working directory
+	cc, err := NewFromDir("tpl", ".", map[string]any{"name": "shop"})
+	require.NoError(t, err)
+	require.NoError(t, cc.Generate(false))
+	data, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "shop\n", string(data))
+
+	// from the working directory
+	t.Chdir(filepath.Join(dir, "tpl"))
+	cc, err = NewFromDir(".", filepath.Join("..", "out"), map[string]any{"name": "cart"})
+	require.NoError(t, err)
+	require.NoError(t, cc.Generate(false))
+	data, err = os.ReadFile(filepath.Join(dir, "out", "a.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "cart\n", string(data))
+}
+
+func TestNewFromDirOverlap(t *testing.T) {
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "README.md"), []byte("# {{ .name }}\n"), 0o644))
+	outDir := filepath.Join(templateDir, "out")
+
+	cc, err := NewFromDir(templateDir, outDir, map[string]any{"name": "shop"})
+	require.NoError(t, err)
+	assert.ErrorIs(t, cc.Generate(false), ErrOutputOverlap)
+	_, err = os.Stat(outDir)
+	assert.True(t, os.IsNotExist(err), "nothing should be generated")
+
+	// forced, the output is generated once, without reading it as a template
+	cc, err = NewFromDir(templateDir, outDir, map[string]any{"name": "shop"}, WithForce())
+	require.NoError(t, err)
+	require.NoError(t, cc.Generate(false))
+	require.NoError(t, cc.Generate(false))
+	entries, err := os.ReadDir(outDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "README.md", entries[0].Name())
+}
@@ -0,0 +1,34 @@
+// Package copycattest provides helpers to test template packs rendered with copycat.
+package copycattest
+
+import (
+	"os"
+	"testing"
+
+	"github.com/quintans/copycat"
+	"github.com/stretchr/testify/assert"
+)
+
+// AssertRendered asserts that a rendered file is equivalent to the expected file at wantPath,
+// ignoring the formatting differences that copycat.Normalize removes for the type of the expected file,
+// like the indentation of JSON. It returns whether the assertion succeeded.
+func AssertRendered(t testing.TB, got []byte, wantPath string) bool {
+	t.Helper()
+
+	want, err := os.ReadFile(wantPath)
+	if err != nil {
+		t.Errorf("reading %s: %v", wantPath, err)
+		return false
+	}
+	normalizedWant, err := copycat.Normalize(wantPath, want)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return false
+	}
+	normalizedGot, err := copycat.Normalize(wantPath, got)
+	if err != nil {
+		t.Errorf("%+v", err)
+		return false
+	}
+	return assert.Equal(t, string(normalizedWant), string(normalizedGot), "rendered content differs from %s", wantPath)
+}
@@ -0,0 +1,23 @@
+package copycattest
+
+import (
+	"testing"
+
+	"github.com/quintans/copycat"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssertRendered(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := `{"port":{{ .port }},"name":"{{ .name }}","features":[{{ range $i, $f := .features }}{{ if $i }},{{ end }}"{{ $f }}"{{ end }}]}`
+	require.NoError(t, afero.WriteFile(inFS, "template/config.json.tmpl", []byte(template), 0o644))
+
+	model := map[string]any{"name": "billing", "port": 8080, "features": []any{"auth", "payments"}}
+	cc, err := copycat.NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	AssertRendered(t, files["config.json"], "testdata/config.json")
+}
@@ -0,0 +1,109 @@
+package copycat
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quintans/faults"
+)
+
+// WithTimezone sets the location of the time returned by now and of the dates formatted by formatDate.
+// Without it, the local timezone is used.
+func WithTimezone(loc *time.Location) Option {
+	return func(cc *CopyCat) {
+		cc.location = loc
+	}
+}
+
+// WithFixedTime makes now always return t, so that the generated output is reproducible, like in tests.
+func WithFixedTime(t time.Time) Option {
+	return func(cc *CopyCat) {
+		cc.fixedTime = &t
+	}
+}
+
+// now returns the current time, or the fixed one, in the configured timezone.
+// It replaces sprig's now.
+//
+// Example: {{ now | formatDate "2006-01-02" }}
+func (cc *CopyCat) now() time.Time {
+	t := time.Now()
+	if cc.fixedTime != nil {
+		t = *cc.fixedTime
+	}
+	return t.In(cc.timezone())
+}
+
+// timezone returns the configured location, the local one by default
+func (cc *CopyCat) timezone() *time.Location {
+	if cc.location != nil {
+		return cc.location
+	}
+	return time.Local
+}
+
+// dateLayouts are the layouts of the date strings accepted by formatDate, like the dates of a model
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly}
+
+// formatDate formats a date with a Go layout in the configured timezone.
+// The date can be a time.Time, a Unix timestamp in seconds or a string in RFC 3339 or 2006-01-02 form.
+// Strings without a timezone are taken as being in the configured one.
+//
+// Example: {{ .releasedAt | formatDate "January 2, 2006" }}
+func (cc *CopyCat) formatDate(layout string, date any) (string, error) {
+	var t time.Time
+	switch v := date.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		t = *v
+	case int:
+		t = time.Unix(int64(v), 0)
+	case int64:
+		t = time.Unix(v, 0)
+	case float64:
+		t = time.Unix(int64(v), 0)
+	case string:
+		var err error
+		for _, l := range dateLayouts {
+			if t, err = time.ParseInLocation(l, v, cc.timezone()); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return "", faults.Errorf("formatDate cannot parse the date %q", v)
+		}
+	default:
+		return "", faults.Errorf("formatDate expects a date, got %T", date)
+	}
+	return t.In(cc.timezone()).Format(layout), nil
+}
+
+// formatNumber formats a number with the given decimal places, rounding it, and with commas separating the thousands.
+//
+// Example: {{ .downloads | formatNumber 0 }} renders 1234567 as 1,234,567
+func formatNumber(decimals int, number any) (string, error) {
+	f, ok := toFloat(number)
+	if !ok {
+		return "", faults.Errorf("formatNumber expects a number, got %T", number)
+	}
+	s := strconv.FormatFloat(math.Abs(f), 'f', max(decimals, 0), 64)
+	integer, fraction, hasFraction := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if f < 0 && strings.Trim(s, "0.") != "" {
+		b.WriteByte('-')
+	}
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	if hasFraction {
+		b.WriteString("." + fraction)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,72 @@
+package copycat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDates(t *testing.T) {
+	lisbon, err := time.LoadLocation("Europe/Lisbon")
+	require.NoError(t, err)
+	fixed := time.Date(2024, time.March, 9, 23, 30, 0, 0, time.UTC)
+
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/CHANGELOG.md.tmpl", []byte(`## {{ .version }} - {{ now | formatDate "2006-01-02" }}
+
+Released {{ .releasedAt | formatDate "January 2, 2006 15:04 MST" }}
+`), 0o644))
+
+	model := map[string]any{"version": "1.2.0", "releasedAt": "2024-07-01T10:00:00Z"}
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithFixedTime(fixed), WithTimezone(lisbon))
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "## 1.2.0 - 2024-03-09\n\nReleased July 1, 2024 11:00 WEST\n", string(files["CHANGELOG.md"]))
+
+	// the fixed time is shown in the timezone
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	require.NoError(t, err)
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithFixedTime(fixed), WithTimezone(tokyo))
+	require.NoError(t, err)
+	tests := map[string]string{
+		`{{ now | formatDate "2006-01-02 15:04" }}`:         "2024-03-10 08:30",
+		`{{ "2024-01-02" | formatDate "Jan 2, 2006 MST" }}`: "Jan 2, 2024 JST",
+		`{{ 0 | formatDate "2006" }}`:                       "1970",
+	}
+	for template, want := range tests {
+		out, err := cc.Render(template, nil)
+		require.NoError(t, err, template)
+		assert.Equal(t, want, out, template)
+	}
+
+	_, err = cc.Render(`{{ "soon" | formatDate "2006" }}`, nil)
+	assert.ErrorContains(t, err, `cannot parse the date "soon"`)
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := []struct {
+		number   any
+		decimals int
+		want     string
+	}{
+		{1234567, 0, "1,234,567"},
+		{1234567.891, 2, "1,234,567.89"},
+		{999, 0, "999"},
+		{-1234.5, 1, "-1,234.5"},
+		{-0.001, 2, "0.00"},
+		{0.5, 0, "0"},
+		{int64(1000), 0, "1,000"},
+	}
+	for _, tt := range tests {
+		got, err := formatNumber(tt.decimals, tt.number)
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, got, "%v", tt.number)
+	}
+
+	_, err := formatNumber(0, "12")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package copycat
+
+import (
+	"os"
+
+	"github.com/quintans/faults"
+)
+
+// WithEnvAllowlist sets the environment variables that templates can read with envOr, and sprig's env and expandenv.
+// Without it, they fail for every variable, so that templates cannot leak arbitrary environment values.
+func WithEnvAllowlist(names ...string) Option {
+	return func(cc *CopyCat) {
+		if cc.envAllowlist == nil {
+			cc.envAllowlist = map[string]bool{}
+		}
+		for _, n := range names {
+			cc.envAllowlist[n] = true
+		}
+	}
+}
+
+// envOr returns the value of an allowed environment variable, or the fallback when it is unset or empty.
+// Reading a variable that is not allowed is an error.
+//
+// Example: {{ envOr "BUILD_NUMBER" "dev" }}
+func (cc *CopyCat) envOr(name, fallback string) (string, error) {
+	v, err := cc.env(name)
+	if err != nil || v != "" {
+		return v, err
+	}
+	return fallback, nil
+}
+
+// env returns the value of an allowed environment variable. It replaces sprig's env.
+//
+// Example: {{ env "BUILD_NUMBER" }}
+func (cc *CopyCat) env(name string) (string, error) {
+	if !cc.envAllowlist[name] {
+		return "", faults.Errorf("environment variable %q is not allowed, allow it with WithEnvAllowlist", name)
+	}
+	return os.Getenv(name), nil
+}
+
+// expandenv replaces the $VAR and ${VAR} references of a string with the values of allowed environment variables.
+// It replaces sprig's expandenv.
+//
+// Example: {{ expandenv "build ${BUILD_NUMBER}" }}
+func (cc *CopyCat) expandenv(s string) (string, error) {
+	var err error
+	expanded := os.Expand(s, func(name string) string {
+		v, e := cc.env(name)
+		if err == nil {
+			err = e
+		}
+		return v
+	})
+	return expanded, err
+}
@@ -0,0 +1,59 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvOr(t *testing.T) {
+	t.Setenv("COPYCAT_BUILD", "42")
+	t.Setenv("COPYCAT_TOKEN", "secret")
+	t.Setenv("COPYCAT_EMPTY", "")
+
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/build.txt.tmpl", []byte(`{{ envOr "COPYCAT_BUILD" "dev" }} {{ envOr "COPYCAT_EMPTY" "none" }} {{ envOr "COPYCAT_UNSET" "none" }}`), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithEnvAllowlist("COPYCAT_BUILD", "COPYCAT_EMPTY"), WithEnvAllowlist("COPYCAT_UNSET"))
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "42 none none", string(files["build.txt"]))
+
+	// a variable that is not allowed fails, even if set
+	require.NoError(t, afero.WriteFile(inFS, "template/token.txt.tmpl", []byte(`{{ envOr "COPYCAT_TOKEN" "" }}`), 0o644))
+	_, err = cc.RunToMap("template")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `environment variable "COPYCAT_TOKEN" is not allowed`)
+
+	// nothing is allowed by default
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{})
+	require.NoError(t, err)
+	_, err = cc.RunToMap("template")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `environment variable "COPYCAT_BUILD" is not allowed`)
+}
+
+func TestEnvAndExpandenvAllowlist(t *testing.T) {
+	t.Setenv("COPYCAT_BUILD", "42")
+	t.Setenv("COPYCAT_NOT_ALLOWED", "secret")
+
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/build.txt.tmpl", []byte(`{{ env "COPYCAT_BUILD" }} {{ expandenv "v${COPYCAT_BUILD}-$COPYCAT_BUILD" }}`), 0o644))
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithEnvAllowlist("COPYCAT_BUILD"))
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "42 v42-42", string(files["build.txt"]))
+
+	for _, content := range []string{`{{ env "COPYCAT_NOT_ALLOWED" }}`, `{{ expandenv "$COPYCAT_BUILD $COPYCAT_NOT_ALLOWED" }}`} {
+		inFS := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(inFS, "template/leak.txt.tmpl", []byte(content), 0o644))
+		cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithEnvAllowlist("COPYCAT_BUILD"))
+		require.NoError(t, err)
+		_, err = cc.RunToMap("template")
+		assert.ErrorContains(t, err, `environment variable "COPYCAT_NOT_ALLOWED" is not allowed`, content)
+	}
+}
@@ -0,0 +1,134 @@
+package copycat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors to check the kind of a failure with errors.Is.
+// The errors carrying them can be recovered with errors.As to get the path involved.
+var (
+	ErrModelLoad       = errors.New("model load failed")
+	ErrTemplateParse   = errors.New("template parse failed")
+	ErrTemplateExecute = errors.New("template execution failed")
+	ErrPathEscape      = errors.New("path escapes output directory")
+	ErrOutputConflict  = errors.New("output conflict")
+	ErrOutputOverlap   = errors.New("output directory inside template directory")
+	ErrFileTooLarge    = errors.New("file too large")
+)
+
+// ModelLoadError is returned when a model file or directory cannot be read or decoded
+type ModelLoadError struct {
+	Path string
+	Err  error
+}
+
+func (e *ModelLoadError) Error() string {
+	return fmt.Sprintf("loading model %s: %s", e.Path, e.Err)
+}
+
+func (e *ModelLoadError) Unwrap() error { return e.Err }
+
+func (e *ModelLoadError) Is(target error) bool { return target == ErrModelLoad }
+
+// TemplateParseError is returned when a template has invalid syntax.
+// Path is the template file, or empty when rendering a string.
+type TemplateParseError struct {
+	Path string
+	Err  error
+}
+
+func (e *TemplateParseError) Error() string {
+	return fmt.Sprintf("parsing template%s: %s", describePath(e.Path), e.Err)
+}
+
+func (e *TemplateParseError) Unwrap() error { return e.Err }
+
+func (e *TemplateParseError) Is(target error) bool { return target == ErrTemplateParse }
+
+// TemplateExecuteError is returned when a template fails to render, e.g. on a missing key or a failing function.
+// Path is the template file, or empty when rendering a string.
+type TemplateExecuteError struct {
+	Path string
+	Err  error
+}
+
+func (e *TemplateExecuteError) Error() string {
+	return fmt.Sprintf("executing template%s: %s", describePath(e.Path), e.Err)
+}
+
+func (e *TemplateExecuteError) Unwrap() error { return e.Err }
+
+func (e *TemplateExecuteError) Is(target error) bool { return target == ErrTemplateExecute }
+
+// PathEscapeError is returned when Name, a template entry name, the output prefix or a manifest entry,
+// expands to Path outside of the output directory
+type PathEscapeError struct {
+	Name string
+	Path string
+}
+
+func (e *PathEscapeError) Error() string {
+	return fmt.Sprintf("path escapes output directory: %q expands to %q", e.Name, e.Path)
+}
+
+func (e *PathEscapeError) Is(target error) bool { return target == ErrPathEscape }
+
+// OutputConflictError is returned when two different template files generate the same output Path in a run
+type OutputConflictError struct {
+	Path   string
+	First  string
+	Second string
+}
+
+func (e *OutputConflictError) Error() string {
+	return fmt.Sprintf("output %q is generated by both %s and %s", e.Path, e.First, e.Second)
+}
+
+func (e *OutputConflictError) Is(target error) bool { return target == ErrOutputConflict }
+
+// CaseConflictError is returned, when checking for case collisions with WithCaseInsensitiveOutput,
+// when the output paths First and Second of a run differ only by case
+type CaseConflictError struct {
+	First  string
+	Second string
+}
+
+func (e *CaseConflictError) Error() string {
+	return fmt.Sprintf("outputs %q and %q differ only by case", e.First, e.Second)
+}
+
+func (e *CaseConflictError) Is(target error) bool { return target == ErrOutputConflict }
+
+// OutputOverlapError is returned when the output directory OutPath is the template directory TemplatePath or is inside it,
+// so that generated files would be read as templates
+type OutputOverlapError struct {
+	TemplatePath string
+	OutPath      string
+}
+
+func (e *OutputOverlapError) Error() string {
+	return fmt.Sprintf("output directory %s is inside the template directory %s", e.OutPath, e.TemplatePath)
+}
+
+func (e *OutputOverlapError) Is(target error) bool { return target == ErrOutputOverlap }
+
+// FileTooLargeError is returned when a template file at Path is larger than the Limit set with WithMaxFileSize
+type FileTooLargeError struct {
+	Path  string
+	Limit int64
+}
+
+func (e *FileTooLargeError) Error() string {
+	return fmt.Sprintf("file too large: %s exceeds the limit of %d bytes", e.Path, e.Limit)
+}
+
+func (e *FileTooLargeError) Is(target error) bool { return target == ErrFileTooLarge }
+
+// describePath formats an optional path to follow a description
+func describePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " " + path
+}
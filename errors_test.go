@@ -0,0 +1,165 @@
+package copycat
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplateExecuteError(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/app/main.go.tmpl", []byte("package {{ .missing }}\n"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrTemplateExecute)
+
+	var execErr *TemplateExecuteError
+	require.True(t, errors.As(err, &execErr))
+	assert.Equal(t, "template/app/main.go.tmpl", execErr.Path)
+}
+
+func TestTemplateParseError(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/main.go.tmpl", []byte("package {{ .name "), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"name": "main"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	var parseErr *TemplateParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, "template/main.go.tmpl", parseErr.Path)
+	assert.ErrorIs(t, err, ErrTemplateParse)
+	assert.NotErrorIs(t, err, ErrTemplateExecute)
+}
+
+func TestModelLoadError(t *testing.T) {
+	_, err := LoadModel("testdata/missing.yaml")
+	var loadErr *ModelLoadError
+	require.True(t, errors.As(err, &loadErr))
+	assert.Equal(t, "testdata/missing.yaml", loadErr.Path)
+	assert.ErrorIs(t, err, ErrModelLoad)
+}
+
+func TestPathEscapeError(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/{{ name }}/file.txt", []byte("content"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"name": "../../etc"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	assert.ErrorIs(t, err, ErrPathEscape)
+	var escapeErr *PathEscapeError
+	require.True(t, errors.As(err, &escapeErr))
+	assert.Equal(t, "{{ name }}", escapeErr.Name)
+}
+
+func TestOutputConflictError(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/config.yaml", []byte("static: true\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ name }}.yaml.tmpl", []byte("name: {{ .name }}\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "config"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", true)
+	assert.ErrorIs(t, err, ErrOutputConflict)
+
+	err = cc.Run("template", "out", false)
+	var conflictErr *OutputConflictError
+	require.True(t, errors.As(err, &conflictErr))
+	assert.Equal(t, "out/config.yaml", conflictErr.Path)
+	assert.Equal(t, "template/config.yaml", conflictErr.First)
+	assert.Equal(t, "template/{{ name }}.yaml.tmpl", conflictErr.Second)
+	assert.Contains(t, err.Error(), "template/config.yaml")
+	assert.Contains(t, err.Error(), "template/{{ name }}.yaml.tmpl")
+}
+
+func TestOutputOverlapError(t *testing.T) {
+	templateDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "README.md"), []byte("# {{ .name }}\n"), 0o644))
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewOsFs(), map[string]any{"name": "shop"})
+	require.NoError(t, err)
+
+	for _, out := range []string{templateDir, filepath.Join(templateDir, "out"), filepath.Join(templateDir, "a", "..", "out")} {
+		err = cc.Run(templateDir, out, false)
+		assert.ErrorIs(t, err, ErrOutputOverlap, out)
+		var overlapErr *OutputOverlapError
+		require.True(t, errors.As(err, &overlapErr))
+		assert.Equal(t, out, overlapErr.OutPath)
+	}
+	_, err = os.Stat(filepath.Join(templateDir, "out"))
+	assert.True(t, os.IsNotExist(err), "nothing should be generated")
+
+	// a sibling directory sharing the name prefix is not inside
+	out := templateDir + "-out"
+	require.NoError(t, os.Mkdir(out, 0o755))
+	t.Cleanup(func() { os.RemoveAll(out) })
+	require.NoError(t, cc.Run(templateDir, out, false))
+}
+
+func TestFileTooLargeError(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/small.txt", []byte("{{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/large.txt", bytes.Repeat([]byte("x"), 100), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"name": "app"}, WithMaxFileSize(64))
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	assert.ErrorIs(t, err, ErrFileTooLarge)
+	var tooLarge *FileTooLargeError
+	require.True(t, errors.As(err, &tooLarge))
+	assert.Equal(t, "template/large.txt", tooLarge.Path)
+	assert.Contains(t, err.Error(), "file too large: template/large.txt exceeds the limit of 64 bytes")
+
+	// files copied verbatim are streamed, whatever their size
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"name": "app"}, WithMaxFileSize(64), WithRenderOnlySuffixed())
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Len(t, files["large.txt"], 100)
+}
+
+func TestCaseConflictError(t *testing.T) {
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "Auth"},
+			map[string]any{"name": "auth"},
+		},
+	}
+	for _, name := range []string{"{{ features.name }}.go", "{{ features.name }}/main.go"} {
+		inFS := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(inFS, "template/"+name, []byte("package {{ .name }}\n"), 0o644))
+
+		// without the option, the paths are different
+		cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false), name)
+
+		cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model, WithCaseInsensitiveOutput())
+		require.NoError(t, err)
+		err = cc.Run("template", "out", false)
+		assert.ErrorIs(t, err, ErrOutputConflict, name)
+		var caseErr *CaseConflictError
+		require.True(t, errors.As(err, &caseErr), name)
+		assert.Contains(t, err.Error(), `"out/Auth`)
+		assert.Contains(t, err.Error(), `"out/auth`)
+	}
+}
@@ -36,8 +36,9 @@ func main() {
 		noError(err, "failed to create output dir: %+v", err)
 	}
 
-	cc, err := copycat.NewCopyCat(
-		afero.FromIOFS{FS: template},
+	cc, err := copycat.NewCopyCatFromFS(
+		template,
+		"template",
 		afero.NewOsFs(),
 		model,
 		copycat.WithCustomFuncs(map[string]any{
@@ -0,0 +1,46 @@
+package copycat
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// RunForEach runs the same template tree once per model, like a list of microservices,
+// each with its own CopyCat created with the options, writing under outBase/name where name is given by nameFn.
+// Names must be single path segments and unique, so that the runs never write into each other.
+// It stops at the first failing model.
+func RunForEach(
+	templateFS, outputFS afero.Fs,
+	models []map[string]any,
+	templatePath, outBase string,
+	nameFn func(model map[string]any) string,
+	options ...Option,
+) error {
+	seen := map[string]int{}
+	for i, model := range models {
+		name := nameFn(model)
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+			return faults.Errorf("model %d is named %q, which is not a single path segment", i, name)
+		}
+		if first, ok := seen[name]; ok {
+			return faults.Errorf("models %d and %d are both named %q", first, i, name)
+		}
+		seen[name] = i
+
+		cc, err := NewCopyCat(templateFS, outputFS, model, options...)
+		if err != nil {
+			return faults.Wrapf(err, "creating CopyCat for %q", name)
+		}
+		outPath := filepath.Join(outBase, name)
+		if err := outputFS.MkdirAll(outPath, cc.outputDirMode()); err != nil {
+			return faults.Wrap(err)
+		}
+		if err := cc.Run(templatePath, outPath, false); err != nil {
+			return faults.Wrapf(err, "running %q", name)
+		}
+	}
+	return nil
+}
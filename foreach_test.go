@@ -0,0 +1,41 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunForEach(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md.tmpl", []byte("# {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/main.go.tmpl", []byte("package {{ .name }}\n"), 0o644))
+
+	models := []map[string]any{
+		{"name": "orders", "features": []any{map[string]any{"name": "billing"}}},
+		{"name": "users", "features": []any{map[string]any{"name": "auth"}}},
+	}
+	name := func(model map[string]any) string { return model["name"].(string) }
+
+	outFS := afero.NewMemMapFs()
+	require.NoError(t, RunForEach(inFS, outFS, models, "template", "services", name))
+
+	for path, want := range map[string]string{
+		"services/orders/README.md":       "# orders\n",
+		"services/orders/billing/main.go": "package billing\n",
+		"services/users/README.md":        "# users\n",
+		"services/users/auth/main.go":     "package auth\n",
+	} {
+		data, err := afero.ReadFile(outFS, path)
+		require.NoError(t, err, path)
+		assert.Equal(t, want, string(data), path)
+	}
+
+	// the names must be unique single path segments
+	err := RunForEach(inFS, afero.NewMemMapFs(), append(models, models[0]), "template", "services", name)
+	assert.ErrorContains(t, err, `models 0 and 2 are both named "orders"`)
+	err = RunForEach(inFS, afero.NewMemMapFs(), []map[string]any{{"name": "../orders"}}, "template", "services", name)
+	assert.ErrorContains(t, err, "not a single path segment")
+}
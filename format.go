@@ -0,0 +1,146 @@
+package copycat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/quintans/faults"
+	"gopkg.in/yaml.v3"
+)
+
+// WithGoFormat formats the generated .go files with gofmt before writing them.
+// A generated file that is not valid Go fails the run, pointing to the file.
+func WithGoFormat() Option {
+	return func(cc *CopyCat) {
+		cc.goFormat = true
+	}
+}
+
+// WithFormatData normalizes the generated .json, .yaml and .yml files so that diffs are clean.
+// JSON is re-emitted with sorted keys and two spaces of indentation. YAML is re-emitted with two spaces of indentation,
+// keeping the key order and the comments. A generated file that does not parse fails the run, pointing to the file.
+func WithFormatData() Option {
+	return func(cc *CopyCat) {
+		cc.formatData = true
+	}
+}
+
+// formatOutput applies the configured formatters to the final content of an output file
+func (cc *CopyCat) formatOutput(outPath, content string) (string, error) {
+	if cc.goFormat && filepath.Ext(outPath) == ".go" {
+		formatted, err := format.Source([]byte(content))
+		if err != nil {
+			return "", faults.Wrapf(err, "formatting Go file %s", outPath)
+		}
+		content = string(formatted)
+	}
+
+	if cc.formatData {
+		var err error
+		switch strings.ToLower(filepath.Ext(outPath)) {
+		case ".json":
+			content, err = formatJSON(content)
+		case ".yaml", ".yml":
+			content, err = formatYAML(content)
+		}
+		if err != nil {
+			return "", faults.Wrapf(err, "formatting data file %s", outPath)
+		}
+	}
+	return content, nil
+}
+
+// Normalize returns the content of a rendered file in a canonical form for its type, given by the extension of path,
+// so that renders differing only in formatting compare equal.
+// JSON and YAML are re-emitted with sorted keys, Go is formatted with gofmt, and other files have the trailing spaces
+// of their lines and their trailing blank lines removed.
+func Normalize(path string, content []byte) ([]byte, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		normalized, err := formatJSON(string(content))
+		if err != nil {
+			return nil, faults.Wrapf(err, "normalizing %s", path)
+		}
+		return []byte(normalized), nil
+	case ".yaml", ".yml":
+		var docs []any
+		dec := yaml.NewDecoder(bytes.NewReader(content))
+		for {
+			var v any
+			err := dec.Decode(&v)
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, faults.Wrapf(err, "normalizing %s", path)
+			}
+			docs = append(docs, v)
+		}
+		normalized, err := yaml.Marshal(docs)
+		if err != nil {
+			return nil, faults.Wrapf(err, "normalizing %s", path)
+		}
+		return normalized, nil
+	case ".go":
+		normalized, err := format.Source(content)
+		if err != nil {
+			return nil, faults.Wrapf(err, "normalizing %s", path)
+		}
+		return normalized, nil
+	}
+
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return []byte(strings.TrimRight(strings.Join(lines, "\n"), "\n")), nil
+}
+
+// formatJSON re-emits JSON with sorted keys and two spaces of indentation, keeping the numbers as written
+func formatJSON(content string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return "", faults.Wrap(err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return "", faults.New("unexpected content after the JSON value")
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	return string(data) + "\n", nil
+}
+
+// formatYAML re-emits all the YAML documents with two spaces of indentation, keeping the key order and comments
+func formatYAML(content string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for {
+		var node yaml.Node
+		err := dec.Decode(&node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", faults.Wrap(err)
+		}
+		if err := enc.Encode(&node); err != nil {
+			return "", faults.Wrap(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", faults.Wrap(err)
+	}
+	return buf.String(), nil
+}
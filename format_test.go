@@ -0,0 +1,105 @@
+package copycat
+
+import (
+	"go/format"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoFormat(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := "package {{ .name }}\nimport \"fmt\"\nfunc  Hello( ) {\nfmt.Println(  \"hello\" )\n    }\n"
+	require.NoError(t, afero.WriteFile(inFS, "template/hello.go.tmpl", []byte(template), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "hello"}, WithGoFormat())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/hello.go")
+	require.NoError(t, err)
+	formatted, err := format.Source(data)
+	require.NoError(t, err)
+	assert.Equal(t, string(formatted), string(data), "output should be gofmt clean")
+	assert.Contains(t, string(data), "func Hello() {\n\tfmt.Println(\"hello\")\n}\n")
+}
+
+func TestGoFormatInvalidCode(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/broken.go.tmpl", []byte("package main\nfunc {\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithGoFormat())
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out/broken.go")
+}
+
+func TestFormatData(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/config.json.tmpl", []byte(`{"name":   "{{ .name }}",
+    "port":8080, "debug" : false,"tags":[ "a","b" ]}`), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/config.yaml.tmpl", []byte("# settings\nname:    {{ .name }}\nlimits:\n      cpu: 1\n      memory: 512Mi\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "api"}, WithFormatData())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/config.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "debug": false,
+  "name": "api",
+  "port": 8080,
+  "tags": [
+    "a",
+    "b"
+  ]
+}
+`, string(data))
+
+	data, err = afero.ReadFile(outFS, "out/config.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "# settings\nname: api\nlimits:\n  cpu: 1\n  memory: 512Mi\n", string(data))
+}
+
+func TestFormatDataInvalidContent(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/config.json", []byte(`{"name": }`), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{}, WithFormatData())
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "out/config.json")
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		path  string
+		a, b  string
+		equal bool
+	}{
+		{path: "a.json", a: `{"b":1,"a":[1,2]}`, b: "{\n  \"a\": [1, 2],\n  \"b\": 1\n}\n", equal: true},
+		{path: "a.json", a: `{"a":1}`, b: `{"a":2}`, equal: false},
+		{path: "a.yaml", a: "b: 1\na: [x, y]\n", b: "a:\n    - x\n    - y\nb: 1\n", equal: true},
+		{path: "a.go", a: "package a\nvar  x=1\n", b: "package a\n\nvar x = 1\n", equal: true},
+		{path: "a.txt", a: "hello  \nworld\n\n", b: "hello\nworld", equal: true},
+	}
+	for _, tt := range tests {
+		a, err := Normalize(tt.path, []byte(tt.a))
+		require.NoError(t, err)
+		b, err := Normalize(tt.path, []byte(tt.b))
+		require.NoError(t, err)
+		assert.Equal(t, tt.equal, string(a) == string(b), "%s: %q vs %q", tt.path, a, b)
+	}
+
+	_, err := Normalize("a.json", []byte("{"))
+	require.Error(t, err)
+}
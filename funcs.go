@@ -0,0 +1,444 @@
+package copycat
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/quintans/faults"
+	"gopkg.in/yaml.v3"
+)
+
+// siblings returns the other elements of the fan-out the current context is one of, in fan-out order,
+// or nothing outside of a fan-out.
+//
+// Example: {{ range siblings }}- {{ .name }}{{ end }}
+func (cc *CopyCat) siblings() []any {
+	frame := cc.current.scope.frame
+	others := make([]any, 0, len(frame.elements))
+	for i, e := range frame.elements {
+		if i != frame.index {
+			others = append(others, e)
+		}
+	}
+	return others
+}
+
+// errSkipFile stops the rendering of a template file that is not to be generated
+var errSkipFile = errors.New("file skipped")
+
+// skip stops rendering the current template file, which is not generated, and removed if left by a previous run,
+// whatever was rendered so far. Unlike rendering empty content, it also skips the files kept by WithEmptyFiles.
+//
+// Example: {{ if not .enabled }}{{ skip }}{{ end }}
+func skip() (string, error) {
+	return "", errSkipFile
+}
+
+// lookup walks the root model along the dotted path and returns the first element
+// whose field (default "name", or "Name" for struct models) matches value, or nil if there is no match.
+//
+// Example: {{ (lookup "features" "billing").table }} or {{ lookup "features" "users" "table" }}
+func (cc *CopyCat) lookup(path string, value any, field ...string) any {
+	key := "name"
+	keys := []string{"name", "Name"}
+	if len(field) > 0 {
+		key = field[0]
+		keys = field[:1]
+	}
+
+	keyPath := splitKeyPath(path)
+	cc.trackKeys(append(keyPath[:len(keyPath):len(keyPath)], key))
+
+	for _, res := range resolveKeyPathWithContext(cc.model, cc.model, keyPath) {
+		candidates := []any{res.result}
+		if arr, ok := res.result.([]any); ok {
+			candidates = arr
+		} else if items, ok := listItems(res.result); ok {
+			candidates = items
+		}
+		for _, c := range candidates {
+			if !isObject(c) {
+				continue
+			}
+			for _, k := range keys {
+				if v, ok := objectField(c, k); ok {
+					if fmt.Sprint(v) == fmt.Sprint(value) {
+						return c
+					}
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// has reports whether the dotted path resolves to a value in the current context, without failing on a missing key.
+// With two arguments it is the has of sprig, reporting whether the list holds the element.
+//
+// Example: {{ if has "owner.email" }}{{ .owner.email }}{{ end }} or {{ has 1 $list }}
+func (cc *CopyCat) has(listHas func(needle, haystack any) bool) func(needle any, haystack ...any) (bool, error) {
+	return func(needle any, haystack ...any) (bool, error) {
+		switch len(haystack) {
+		case 0:
+			path, ok := needle.(string)
+			if !ok {
+				return false, faults.Errorf("has expects a dotted path, got %T", needle)
+			}
+			keyPath := splitKeyPath(path)
+			cc.trackKeys(keyPath)
+			ctx := cc.current.ctx
+			return len(resolveKeyPathWithContext(ctx, ctx, keyPath)) > 0, nil
+		case 1:
+			return listHas(needle, haystack[0]), nil
+		default:
+			return false, faults.Errorf("has expects a path or an element and a list, got %d arguments", len(haystack)+1)
+		}
+	}
+}
+
+// get walks the dotted path from data and returns the value found, or the fallback when the path is missing or null,
+// without failing on a missing key. Without a fallback, a missing path is an empty string, like the get of sprig.
+//
+// Example: {{ get . "owner.email" "none@example.com" }}
+func (cc *CopyCat) get(data any, path string, fallback ...any) any {
+	var value any
+	if m, ok := data.(map[string]any); ok && m[path] != nil {
+		// a key with dots of its own
+		value = m[path]
+	} else {
+		keyPath := splitKeyPath(path)
+		cc.trackKeys(keyPath)
+		if values := resolveKeyPathWithContext(data, data, keyPath); len(values) > 0 {
+			value = values[0].result
+		}
+	}
+
+	if value != nil {
+		return value
+	}
+	if len(fallback) > 0 {
+		return fallback[0]
+	}
+	return ""
+}
+
+// include reads a file relative to the directory of the template being rendered
+// and returns it rendered with the current context.
+//
+// Example: {{ include "snippets/header.txt" }}
+func (cc *CopyCat) include(name string, ctx any, scope renderScope) (string, error) {
+	if scope.depth >= maxIncludeDepth {
+		return "", faults.Errorf("include depth limit of %d exceeded while including %q", maxIncludeDepth, name)
+	}
+
+	path := filepath.Join(scope.templateDir, name)
+	if err := cc.checkTemplatePath(name, path); err != nil {
+		return "", faults.Wrap(err)
+	}
+	data, err := cc.readTemplate(path)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+
+	return cc.renderScoped(string(data), ctx, renderScope{
+		templateDir:  filepath.Dir(path),
+		depth:        scope.depth + 1,
+		parent:       scope.parent,
+		frame:        scope.frame,
+		dirFrame:     scope.dirFrame,
+		file:         path,
+		outputPath:   scope.outputPath,
+		templatePath: scope.templatePath,
+	})
+}
+
+// file returns the content of a file of the OS filesystem, relative to the directory set with WithFileDir,
+// or the working directory. It is available to the model values too.
+//
+// Example: license: "{{ file \"LICENSE.txt\" }}"
+func (cc *CopyCat) file(name string) (string, error) {
+	base := cc.fileDir
+	if base == "" {
+		base = "."
+	}
+	path := filepath.Join(base, name)
+	if filepath.IsAbs(name) || !isWithinDir(base, path) {
+		return "", faults.Errorf("file %q is outside of the base directory %q", name, base)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	return string(data), nil
+}
+
+// templateFile returns the content of a file of the template filesystem, relative to the root of the template tree
+// being run, whatever the directory of the current template. Files outside of the template tree cannot be read.
+//
+// Example: {{ templateFile "VERSION" | trim }}
+func (cc *CopyCat) templateFile(name string) (string, error) {
+	path := filepath.Join(cc.run.templateRoot, name)
+	if err := cc.checkTemplatePath(name, path); err != nil {
+		return "", faults.Wrap(err)
+	}
+
+	data, err := cc.readTemplate(path)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	return string(data), nil
+}
+
+// checkTemplatePath fails when the path of a file read by a template, named name, is outside of the template directory,
+// so that templates and the model values they are given cannot read any file, like with the OS filesystem
+func (cc *CopyCat) checkTemplatePath(name, path string) error {
+	base := cc.run.templateRoot
+	if base == "" {
+		base = "."
+	}
+	if filepath.IsAbs(name) || !isWithinDir(base, path) {
+		return faults.Errorf("template file %q is outside of the template directory %q", name, base)
+	}
+	return nil
+}
+
+// fromYaml decodes YAML into a structured value, ignoring errors, like sprig's fromJson.
+//
+// Example: {{ $cfg := fromYaml (file "config.yaml") }}{{ $cfg.port }}
+func fromYaml(v string) any {
+	output, _ := mustFromYaml(v)
+	return output
+}
+
+// mustFromYaml decodes YAML into a structured value, returning errors
+func mustFromYaml(v string) (any, error) {
+	var output any
+	if err := yaml.Unmarshal([]byte(v), &output); err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return normalizeValue(output), nil
+}
+
+// toYaml encodes a value into a YAML string, without the final newline, ignoring errors
+func toYaml(v any) string {
+	output, _ := mustToYaml(v)
+	return output
+}
+
+// mustToYaml encodes a value into a YAML string, without the final newline, returning errors
+func mustToYaml(v any) (string, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// indentBlock reindents a multi-line block to be inserted at a column: the common indentation of its lines is removed
+// and every line but the first, which continues the insertion line, is indented with spaces. Blank lines stay empty.
+//
+// Example:
+//
+//	services:
+//	    {{ include "snippets/db.yaml" | indentBlock 4 }}
+func indentBlock(spaces int, text string) string {
+	lines := strings.Split(text, "\n")
+
+	common := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if common < 0 || n < common {
+			common = n
+		}
+	}
+
+	pad := strings.Repeat(" ", spaces)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+			continue
+		}
+		line = line[common:]
+		if i > 0 {
+			line = pad + line
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// tpl renders a string as a template with the given context, like a model value excluded from model rendering.
+//
+// Example: {{ tpl .snippet . }}
+func (cc *CopyCat) tpl(text string, ctx any, scope renderScope) (string, error) {
+	if scope.depth >= maxIncludeDepth {
+		return "", faults.Errorf("template nesting limit of %d exceeded while rendering %q", maxIncludeDepth, text)
+	}
+	scope.depth++
+	return cc.renderScoped(text, ctx, scope)
+}
+
+// relPath returns the relative path from the directory base to target, both with forward slashes,
+// like filepath.Rel. Use it to link generated files to each other.
+//
+// Example: {{ relPath (dir outputPath) "docs/README.md" }}
+func relPath(base, target string) (string, error) {
+	rel, err := filepath.Rel(filepath.FromSlash(base), filepath.FromSlash(target))
+	if err != nil {
+		return "", faults.Wrap(err)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// modulePath returns the Go import path of a directory relative to the output directory,
+// under the module set with WithModulePath.
+//
+// Example: import "{{ modulePath (printf "internal/%s" .name) }}"
+func (cc *CopyCat) modulePath(dir string) (string, error) {
+	if cc.module == "" {
+		return "", faults.New("modulePath requires a module, set with WithModulePath")
+	}
+	dir = path.Clean(filepath.ToSlash(dir))
+	if path.IsAbs(dir) || dir == ".." || strings.HasPrefix(dir, "../") {
+		return "", faults.Errorf("modulePath %q is outside of the module", dir)
+	}
+	if dir == "." {
+		return cc.module, nil
+	}
+	return cc.module + "/" + dir, nil
+}
+
+// namespaceURL is the RFC 4122 namespace for URLs
+var namespaceURL = [16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// stableIDNamespace is the namespace of the IDs generated by stableID
+var stableIDNamespace = uuidV5(namespaceURL, "https://github.com/quintans/copycat")
+
+// stableID returns a deterministic UUID (version 5) derived from the values,
+// so that regenerating the same model yields the same IDs.
+//
+// Example: {{ stableID .name }} or {{ stableID (root).projectName .name }}
+func stableID(values ...any) string {
+	// each part is prefixed by its length, so that "a/b" and "a" "b" yield different IDs
+	var name strings.Builder
+	for _, v := range values {
+		s := fmt.Sprint(v)
+		fmt.Fprintf(&name, "%d:%s", len(s), s)
+	}
+	return formatUUID(uuidV5(stableIDNamespace, name.String()))
+}
+
+// formatUUID formats a UUID in its canonical form, like 6ba7b811-9dad-11d1-80b4-00c04fd430c8
+func formatUUID(u [16]byte) string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// sortedKeys returns the keys of the maps, without duplicates, in sorted order,
+// unlike the keys of sprig, whose order is random.
+//
+// Example: {{ range sortedKeys .services }}- {{ . }}{{ end }}
+func sortedKeys(dicts ...map[string]any) []string {
+	var keys []string
+	for _, d := range dicts {
+		for k := range d {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return slices.Compact(keys)
+}
+
+// uniqSorted returns the elements of the lists, without duplicates, in sorted order: numbers by value and anything else by its text.
+// Unlike sprig's uniq and sortAlpha, it keeps the elements as they are, whatever their type.
+//
+// Example: {{ range uniqSorted .imports }}	"{{ . }}"{{ end }}
+func uniqSorted(lists ...any) ([]any, error) {
+	var elements []any
+	for _, list := range lists {
+		items, err := listElements(list)
+		if err != nil {
+			return nil, faults.Wrapf(err, "uniqSorted")
+		}
+		for _, item := range items {
+			if !slices.ContainsFunc(elements, func(e any) bool { return reflect.DeepEqual(e, item) }) {
+				elements = append(elements, item)
+			}
+		}
+	}
+	slices.SortStableFunc(elements, compareValues)
+	return elements, nil
+}
+
+// flatten returns the elements of the lists, and of the lists nested in them, in a single list.
+// Missing lists and nil elements are left out.
+//
+// Example: {{ $all := list }}{{ range .features }}{{ $all = append $all .imports }}{{ end }}{{ uniqSorted (flatten $all) }}
+func flatten(lists ...any) []any {
+	var elements []any
+	for _, list := range lists {
+		items, err := listElements(list)
+		if err != nil {
+			// not a list
+			elements = append(elements, list)
+			continue
+		}
+		elements = append(elements, flatten(items...)...)
+	}
+	return elements
+}
+
+// listElements returns the elements of a slice or array of any type
+func listElements(list any) ([]any, error) {
+	v := reflect.ValueOf(list)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]any, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).Interface()
+		}
+		return items, nil
+	case reflect.Invalid:
+		return nil, nil
+	default:
+		return nil, faults.Errorf("expected a list, got %T", list)
+	}
+}
+
+// modelHash returns the SHA-256, in hex, of the root model in canonical JSON, with sorted keys,
+// so that the same model always yields the same hash, e.g. to detect when the output must be regenerated.
+//
+// Example: // model: {{ modelHash }}
+func (cc *CopyCat) modelHash() (string, error) {
+	data, err := json.Marshal(cc.model)
+	if err != nil {
+		return "", faults.Wrapf(err, "hashing the model")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// uuidV5 computes a name based UUID using SHA-1, as defined by RFC 4122
+func uuidV5(namespace [16]byte, name string) [16]byte {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+
+	var u [16]byte
+	copy(u[:], h.Sum(nil))
+	u[6] = (u[6] & 0x0f) | 0x50 // version 5
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return u
+}
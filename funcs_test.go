@@ -0,0 +1,433 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookup(t *testing.T) {
+	model := map[string]any{
+		"projectName": "Complex App",
+		"features": []any{
+			map[string]any{"name": "authentication", "table": "auth_users", "enabled": true},
+			map[string]any{"name": "billing", "table": "invoices", "enabled": false},
+		},
+	}
+
+	cc := CopyCat{
+		model: model,
+	}
+
+	rendered, err := cc.renderContent(`{{ (lookup "features" "billing").table }}`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "invoices", rendered)
+
+	// predicate on a named field
+	rendered, err = cc.renderContent(`{{ (lookup "features" "auth_users" "table").name }}`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "authentication", rendered)
+
+	rendered, err = cc.renderContent(`{{ (lookup "features" true "enabled").name }}`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "authentication", rendered)
+
+	assert.Nil(t, cc.lookup("features", "shipping"))
+	assert.Nil(t, cc.lookup("nonexistent", "billing"))
+}
+
+func TestLookupStructModel(t *testing.T) {
+	type feature struct {
+		Name  string
+		Table string
+	}
+	model := struct {
+		Features []feature
+	}{
+		Features: []feature{{Name: "authentication", Table: "auth_users"}, {Name: "billing", Table: "invoices"}},
+	}
+
+	cc, err := NewCopyCatFromStruct(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+
+	rendered, err := cc.renderContent(`{{ (lookup "Features" "billing").Table }}`, cc.model)
+	require.NoError(t, err)
+	assert.Equal(t, "invoices", rendered)
+
+	rendered, err = cc.renderContent(`{{ (lookup "Features" "auth_users" "Table").Name }}`, cc.model)
+	require.NoError(t, err)
+	assert.Equal(t, "authentication", rendered)
+
+	assert.Nil(t, cc.lookup("Features", "shipping"))
+}
+
+func TestHas(t *testing.T) {
+	model := map[string]any{
+		"owner":    map[string]any{"name": "Acme"},
+		"features": []any{"auth", "billing"},
+	}
+	cc := CopyCat{model: model}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: `{{ has "owner.name" }}`, expected: "true"},
+		{template: `{{ has "owner.email" }}`, expected: "false"},
+		{template: `{{ has "owner.email.domain" }}`, expected: "false"},
+		{template: `{{ has "missing" }}`, expected: "false"},
+		{template: `{{ if has "owner.email" }}{{ .owner.email }}{{ else }}no email{{ end }}`, expected: "no email"},
+		// sprig's list membership is still available
+		{template: `{{ has "billing" .features }}`, expected: "true"},
+		{template: `{{ has "shipping" .features }}`, expected: "false"},
+	}
+	for _, tt := range tests {
+		rendered, err := cc.renderContent(tt.template, model)
+		require.NoError(t, err, tt.template)
+		assert.Equal(t, tt.expected, rendered, tt.template)
+	}
+}
+
+func TestGet(t *testing.T) {
+	model := map[string]any{
+		"owner":    map[string]any{"name": "Acme", "phone": nil},
+		"dotted.k": "literal",
+	}
+	cc := CopyCat{model: model}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{template: `{{ get . "owner.name" "Nobody" }}`, expected: "Acme"},
+		{template: `{{ get . "owner.email" "none@example.com" }}`, expected: "none@example.com"},
+		{template: `{{ get . "owner.phone" "n/a" }}`, expected: "n/a"},
+		{template: `{{ get .owner "email" }}`, expected: ""},
+		{template: `{{ get . "dotted.k" }}`, expected: "literal"},
+		{template: `{{ (get . "owner" dict).name }}`, expected: "Acme"},
+	}
+	for _, tt := range tests {
+		rendered, err := cc.renderContent(tt.template, model)
+		require.NoError(t, err, tt.template)
+		assert.Equal(t, tt.expected, rendered, tt.template)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/app/snippets/header.txt", []byte("// Project {{ .projectName }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/app/main.go.tmpl", []byte("{{ include \"snippets/header.txt\" }}\npackage main\n"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"projectName": "Included"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/app/main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "// Project Included\npackage main\n", string(data))
+}
+
+func TestIncludeOutsideTemplates(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "secret.txt", []byte("secret"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/app/sibling.txt", []byte("sibling"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/app/main.go.tmpl", []byte(`{{ include "sibling.txt" }} {{ include .snippet }}`), 0o644))
+
+	for _, snippet := range []string{"../../secret.txt", "/secret.txt"} {
+		cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"snippet": snippet})
+		require.NoError(t, err)
+		err = cc.Run("template", "out", false)
+		assert.ErrorContains(t, err, "is outside of the template directory", snippet)
+	}
+
+	// climbing within the templates is fine
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"snippet": "../app/sibling.txt"})
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "sibling sibling", string(files["app/main.go"]))
+}
+
+func TestIndentBlock(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/snippets/db.yaml", []byte("  db:\n    image: {{ .image }}\n"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/compose.yaml.tmpl", []byte("services:\n    {{ include \"snippets/db.yaml\" | indentBlock 4 }}"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"image": "postgres"})
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/compose.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "services:\n    db:\n      image: postgres\n", string(data))
+}
+
+func TestFile(t *testing.T) {
+	model := map[string]any{
+		"license": `{{ file "LICENSE.txt" }}`,
+	}
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model, WithFileDir("testdata/files"))
+	require.NoError(t, err)
+	assert.Equal(t, "MIT License\n\nCopyright (c) Acme\n", cc.model["license"])
+
+	out, err := cc.Render(`{{ file "LICENSE.txt" | trim }}`, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "MIT License\n\nCopyright (c) Acme", out)
+
+	for _, name := range []string{"../model_test.go", "/etc/passwd"} {
+		_, err = cc.Render(`{{ file "`+name+`" }}`, nil)
+		require.Error(t, err, name)
+		assert.Contains(t, err.Error(), "outside of the base directory")
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/VERSION", []byte("1.4.2\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/cmd/{{ name }}/internal/version.go.tmpl", []byte(`package internal
+
+const Version = "{{ templateFile "VERSION" | trim }}"
+`), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "secret.txt", []byte("secret"), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{"name": "app"})
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "package internal\n\nconst Version = \"1.4.2\"\n", string(files["cmd/app/internal/version.go"]))
+
+	require.NoError(t, afero.WriteFile(inFS, "template/escape.txt", []byte(`{{ templateFile "../secret.txt" }}`), 0o644))
+	_, err = cc.RunToMap("template")
+	assert.ErrorContains(t, err, "outside of the template directory")
+}
+
+func TestStructuredDataHelpers(t *testing.T) {
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), map[string]any{})
+	require.NoError(t, err)
+
+	ctx := map[string]any{
+		"name":  "api",
+		"ports": []any{80, 443},
+		"db":    map[string]any{"host": "localhost"},
+	}
+
+	out, err := cc.Render(`{{ $v := fromYaml (toYaml .) }}{{ $v.name }} {{ index $v.ports 1 }} {{ $v.db.host }}`, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "api 443 localhost", out)
+
+	out, err = cc.Render(`{{ $v := fromJson (toJson .) }}{{ $v.name }} {{ index $v.ports 1 }} {{ $v.db.host }}`, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "api 443 localhost", out)
+
+	out, err = cc.Render(`{{ toYaml .db }}`, ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "host: localhost", out)
+
+	_, err = cc.Render(`{{ mustFromYaml "a: [" }}`, nil)
+	require.Error(t, err)
+}
+
+func TestOutputAndTemplatePath(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/snippets/header.txt", []byte("// Code generated by copycat from {{ templatePath }}. DO NOT EDIT.\n"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte("{{ include \"../snippets/header.txt\" }}// {{ outputPath }}\npackage {{ .name }}\n"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{"features": []any{map[string]any{"name": "auth"}}}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/auth/auth.go")
+	require.NoError(t, err)
+	assert.Equal(t, "// Code generated by copycat from {{ features.name }}/{{ name }}.go.tmpl. DO NOT EDIT.\n// auth/auth.go\npackage auth\n", string(data))
+}
+
+func TestRelPathAndModulePath(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	template := `import "{{ modulePath (dir outputPath) }}"
+see {{ relPath (dir outputPath) "payments/payments.go" }}
+`
+	err := afero.WriteFile(inFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte(template), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{"features": []any{map[string]any{"name": "auth"}}}
+	cc, err := NewCopyCat(inFS, outFS, model, WithModulePath("github.com/acme/shop"))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/auth/auth.go")
+	require.NoError(t, err)
+	assert.Equal(t, "import \"github.com/acme/shop/auth\"\nsee ../payments/payments.go\n", string(data))
+
+	_, err = cc.Render(`{{ modulePath "../x" }}`, nil)
+	require.Error(t, err)
+}
+
+func TestIncludeDepthLimit(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "loop.txt", []byte(`{{ include "loop.txt" }}`), 0o644)
+	require.NoError(t, err)
+
+	cc := CopyCat{
+		templateFS: inFS,
+	}
+	_, err = cc.renderContent(`{{ include "loop.txt" }}`, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "include depth limit")
+}
+func TestParent(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/{{ modules.name }}/{{ features.name }}.txt", []byte("{{ .name }} in {{ parent.name }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ modules.name }}/{{ name }}/module.txt", []byte("{{ .name }} of {{ parent.projectName }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"projectName": "App",
+		"modules": []any{
+			map[string]any{
+				"name": "core",
+				"features": []any{
+					map[string]any{"name": "auth"},
+					map[string]any{"name": "billing"},
+				},
+			},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	expected := map[string]string{
+		"out/core/auth.txt":        "auth in core",
+		"out/core/billing.txt":     "billing in core",
+		"out/core/core/module.txt": "core of App",
+	}
+	for path, content := range expected {
+		data, err := afero.ReadFile(outFS, path)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+}
+
+func TestStableID(t *testing.T) {
+	cc := CopyCat{}
+
+	render := func(name string) string {
+		rendered, err := cc.renderContent(`{{ stableID .name }}`, map[string]any{"name": name})
+		require.NoError(t, err)
+		return rendered
+	}
+
+	auth := render("auth")
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-5[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, auth)
+	assert.Equal(t, auth, render("auth"), "same input should yield the same ID")
+	assert.NotEqual(t, auth, render("billing"), "different inputs should yield different IDs")
+	assert.Equal(t, auth, stableID("auth"))
+
+	// the parts are not ambiguous
+	assert.NotEqual(t, stableID("a/b"), stableID("a", "b"))
+	assert.NotEqual(t, stableID("a", "b/c"), stableID("a/b", "c"))
+	assert.NotEqual(t, stableID("ab"), stableID("a", "b"))
+}
+
+func TestModelHash(t *testing.T) {
+	hash := func(model map[string]any) string {
+		cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+		require.NoError(t, err)
+		rendered, err := cc.Render(`{{ modelHash }}`, model)
+		require.NoError(t, err)
+		return rendered
+	}
+
+	model := func() map[string]any {
+		return map[string]any{
+			"name":     "shop",
+			"slug":     "{{ lower .name }}",
+			"features": []any{map[string]any{"name": "auth", "enabled": true}},
+		}
+	}
+	h := hash(model())
+	assert.Regexp(t, `^[0-9a-f]{64}$`, h)
+	assert.Equal(t, h, hash(model()), "same model should yield the same hash")
+
+	changed := model()
+	changed["features"].([]any)[0].(map[string]any)["enabled"] = false
+	assert.NotEqual(t, h, hash(changed), "a changed model should yield a different hash")
+}
+
+func TestSortedKeys(t *testing.T) {
+	model := map[string]any{
+		"features": map[string]any{
+			"payments": map[string]any{"table": "payments"},
+			"auth":     map[string]any{"table": "users"},
+			"billing":  map[string]any{"table": "invoices"},
+		},
+		"extra": map[string]any{"auth": true, "search": true},
+	}
+	cc := CopyCat{model: model}
+
+	rendered, err := cc.renderContent(`{{ range sortedKeys .features }}- {{ . }} ({{ (index $.features .).table }})
+{{ end }}`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "- auth (users)\n- billing (invoices)\n- payments (payments)\n", rendered)
+
+	assert.Equal(t, []string{"auth", "billing", "payments", "search"}, sortedKeys(model["features"].(map[string]any), model["extra"].(map[string]any)))
+}
+
+func TestUniqSorted(t *testing.T) {
+	model := map[string]any{
+		"imports": []any{"strings", "fmt", "os", "fmt"},
+		"features": []any{
+			map[string]any{"name": "auth", "imports": []any{"crypto/sha256", "fmt"}},
+			map[string]any{"name": "billing", "imports": []any{"time", "crypto/sha256"}},
+		},
+		"ports": []any{8080, 443, 8080, 80},
+	}
+	cc := CopyCat{model: model}
+
+	rendered, err := cc.renderContent(`{{ $all := list .imports }}{{ range .features }}{{ $all = append $all .imports }}{{ end -}}
+import (
+{{- range uniqSorted (flatten $all) }}
+	"{{ . }}"
+{{- end }}
+)`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "import (\n\t\"crypto/sha256\"\n\t\"fmt\"\n\t\"os\"\n\t\"strings\"\n\t\"time\"\n)", rendered)
+
+	// numbers are sorted by value
+	rendered, err = cc.renderContent(`{{ uniqSorted .ports }}`, model)
+	require.NoError(t, err)
+	assert.Equal(t, "[80 443 8080]", rendered)
+
+	_, err = cc.renderContent(`{{ uniqSorted "fmt" }}`, model)
+	assert.ErrorContains(t, err, "expected a list")
+
+	assert.Equal(t, []any{1, 2, "a", 3}, flatten([]any{1, []any{2, []string{"a"}}, nil}, []int{3}, nil))
+}
@@ -0,0 +1,69 @@
+package copycat
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// CloneGitFs shallow clones a git repository and returns its tree as an in-memory afero.Fs,
+// ready to be used as the template filesystem.
+// ref is the branch or tag to clone. If empty, the default branch is used.
+//
+// It requires the git executable to be available.
+func CloneGitFs(ctx context.Context, url, ref string) (afero.Fs, error) {
+	dir, err := os.MkdirTemp("", "copycat-git-")
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", url, dir)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, faults.Wrapf(err, "cloning %s: %s", url, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	memFS := afero.NewMemMapFs()
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return faults.Wrap(memFS.MkdirAll(rel, 0o755))
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		return faults.Wrap(afero.WriteFile(memFS, rel, data, info.Mode().Perm()))
+	})
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return memFS, nil
+}
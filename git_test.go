@@ -0,0 +1,54 @@
+package copycat
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneGitFs(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	// create a bare repository fixture with two versions of the template
+	work := t.TempDir()
+	bare := filepath.Join(t.TempDir(), "templates.git")
+	git := func(dir string, args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	git(work, "init", "--quiet")
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "template", "{{ projectName }}"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(work, "template", "{{ projectName }}", "README.md"), []byte("# {{ .projectName }} v1"), 0o644))
+	git(work, "add", ".")
+	git(work, "commit", "--quiet", "-m", "v1")
+	git(work, "tag", "v1")
+	require.NoError(t, os.WriteFile(filepath.Join(work, "template", "{{ projectName }}", "README.md"), []byte("# {{ .projectName }} v2"), 0o644))
+	git(work, "commit", "--quiet", "-am", "v2")
+	git(work, "clone", "--quiet", "--bare", work, bare)
+
+	templateFS, err := CloneGitFs(context.Background(), "file://"+bare, "v1")
+	require.NoError(t, err)
+
+	_, err = templateFS.Stat(".git")
+	assert.True(t, os.IsNotExist(err), "git metadata should not be part of the templates")
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(templateFS, outFS, map[string]any{"projectName": "App"})
+	require.NoError(t, err)
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/App/README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# App v1", string(data))
+}
@@ -3,6 +3,7 @@ module github.com/quintans/copycat
 go 1.25.1
 
 require (
+	github.com/fsnotify/fsnotify v1.10.1
 	github.com/go-task/slim-sprig/v3 v3.0.0
 	github.com/quintans/faults v1.8.0
 	github.com/spf13/afero v1.15.0
@@ -13,5 +14,6 @@ require (
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 )
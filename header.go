@@ -0,0 +1,48 @@
+package copycat
+
+import (
+	"strings"
+
+	"github.com/quintans/faults"
+)
+
+// generatedHeader is a header prepended to the generated files matching a predicate
+type generatedHeader struct {
+	template string
+	match    func(path string) bool
+}
+
+// WithGeneratedHeader prepends a header to the rendered files whose output path, relative to the output directory,
+// matches the predicate. The header is a template rendered like the file, so it can use outputPath or templatePath,
+// and it should use the comment syntax of the matched files. It is not added again if the file already has it.
+//
+// Example:
+//
+//	WithGeneratedHeader("// Code generated by copycat; DO NOT EDIT.\n", func(path string) bool {
+//		return strings.HasSuffix(path, ".go")
+//	})
+func WithGeneratedHeader(template string, match func(path string) bool) Option {
+	return func(cc *CopyCat) {
+		cc.generatedHeader = &generatedHeader{template: template, match: match}
+	}
+}
+
+// addGeneratedHeader prepends the rendered generated header to the content of a file, if it applies and is missing
+func (cc *CopyCat) addGeneratedHeader(content string, ctx any, scope renderScope) (string, error) {
+	h := cc.generatedHeader
+	if h == nil || !h.match(scope.outputPath) {
+		return content, nil
+	}
+
+	header, err := cc.renderScoped(h.template, ctx, scope)
+	if err != nil {
+		return "", faults.Wrapf(err, "rendering generated header")
+	}
+	if strings.TrimSpace(header) == "" || strings.Contains(content, strings.TrimSpace(header)) {
+		return content, nil
+	}
+	if !strings.HasSuffix(header, "\n") {
+		header += "\n"
+	}
+	return header + content, nil
+}
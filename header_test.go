@@ -0,0 +1,36 @@
+package copycat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeneratedHeader(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/main.go.tmpl", []byte("package main\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/types.go", []byte("// Code generated by copycat; DO NOT EDIT.\n\npackage main\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("readme\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{}, WithGeneratedHeader(
+		"// Code generated by copycat; DO NOT EDIT.\n",
+		func(path string) bool { return strings.HasSuffix(path, ".go") },
+	))
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	for _, name := range []string{"out/main.go", "out/types.go"} {
+		data, err := afero.ReadFile(outFS, name)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), "// Code generated by copycat; DO NOT EDIT.\n"), name)
+		assert.Equal(t, 1, strings.Count(string(data), "DO NOT EDIT"), name)
+	}
+
+	data, err := afero.ReadFile(outFS, "out/README.md")
+	require.NoError(t, err)
+	assert.Equal(t, "readme\n", string(data))
+}
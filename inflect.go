@@ -0,0 +1,138 @@
+package copycat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// irregularPlurals maps the singular of the irregular English nouns to their plural
+var irregularPlurals = map[string]string{
+	"person": "people", "man": "men", "woman": "women", "child": "children", "tooth": "teeth",
+	"foot": "feet", "mouse": "mice", "goose": "geese", "ox": "oxen", "leaf": "leaves",
+	"life": "lives", "knife": "knives", "wife": "wives", "half": "halves", "wolf": "wolves",
+	"shelf": "shelves", "calf": "calves", "loaf": "loaves", "thief": "thieves", "hero": "heroes",
+	"potato": "potatoes", "tomato": "tomatoes", "echo": "echoes", "quiz": "quizzes", "index": "indices",
+	"matrix": "matrices", "vertex": "vertices", "criterion": "criteria", "datum": "data", "medium": "media",
+	// regular, but not singularized by the -ies rule
+	"movie": "movies", "cookie": "cookies", "pie": "pies", "tie": "ties", "lie": "lies",
+}
+
+// irregularSingulars maps the plural of the irregular English nouns to their singular
+var irregularSingulars = func() map[string]string {
+	m := make(map[string]string, len(irregularPlurals))
+	for singular, plural := range irregularPlurals {
+		m[plural] = singular
+	}
+	return m
+}()
+
+// uncountables are the nouns whose plural is the singular
+var uncountables = map[string]bool{
+	"sheep": true, "fish": true, "deer": true, "series": true, "species": true, "news": true,
+	"information": true, "equipment": true, "money": true, "rice": true, "metadata": true, "feedback": true,
+}
+
+// plural returns the English plural of the last word of s, keeping its case.
+//
+// Example: {{ "person" | plural }} renders people and {{ "OrderItem" | plural }} renders OrderItems
+func plural(s string) string {
+	return inflectLastWord(s, pluralWord)
+}
+
+// singular returns the English singular of the last word of s, keeping its case.
+//
+// Example: {{ "people" | singular }} renders person and {{ "order_items" | singular }} renders order_item
+func singular(s string) string {
+	return inflectLastWord(s, singularWord)
+}
+
+func pluralWord(w string) string {
+	if p, ok := irregularPlurals[w]; ok {
+		return p
+	}
+	if uncountables[w] || irregularSingulars[w] != "" {
+		return w
+	}
+	switch {
+	case strings.HasSuffix(w, "is"):
+		// analysis -> analyses
+		return strings.TrimSuffix(w, "is") + "es"
+	case hasAnySuffix(w, "s", "x", "z", "ch", "sh"):
+		return w + "es"
+	case strings.HasSuffix(w, "y") && len(w) > 1 && !isVowel(rune(w[len(w)-2])):
+		return strings.TrimSuffix(w, "y") + "ies"
+	}
+	return w + "s"
+}
+
+func singularWord(w string) string {
+	if s, ok := irregularSingulars[w]; ok {
+		return s
+	}
+	if uncountables[w] || irregularPlurals[w] != "" {
+		return w
+	}
+	switch {
+	case strings.HasSuffix(w, "yses"):
+		// analyses -> analysis
+		return strings.TrimSuffix(w, "es") + "is"
+	case strings.HasSuffix(w, "ies") && len(w) > 4:
+		return strings.TrimSuffix(w, "ies") + "y"
+	case hasAnySuffix(w, "sses", "xes", "zes", "ches", "shes", "iases"),
+		// statuses -> status, but houses -> house
+		strings.HasSuffix(w, "uses") && len(w) > 4 && !isVowel(rune(w[len(w)-5])):
+		// aliases -> alias, but databases -> database and ideas -> idea
+		return strings.TrimSuffix(w, "es")
+	case hasAnySuffix(w, "ss", "us", "is", "ias"):
+		// class, status, analysis and alias are already singular
+		return w
+	case strings.HasSuffix(w, "s"):
+		return strings.TrimSuffix(w, "s")
+	}
+	return w
+}
+
+// inflectLastWord applies the inflection to the last word of s, like Item in OrderItem or items in order_items,
+// restoring the case of the original word
+func inflectLastWord(s string, inflect func(string) string) string {
+	runes := []rune(s)
+	start := len(runes)
+	for start > 0 && unicode.IsLetter(runes[start-1]) {
+		start--
+		// a camel case word starts at an upper case letter following a lower case one
+		if unicode.IsUpper(runes[start]) && start > 0 && unicode.IsLower(runes[start-1]) {
+			break
+		}
+	}
+	word := string(runes[start:])
+	if word == "" {
+		return s
+	}
+	return string(runes[:start]) + matchCase(word, inflect(strings.ToLower(word)))
+}
+
+// matchCase returns inflected in the case of word: upper case, capitalized or lower case
+func matchCase(word, inflected string) string {
+	if word == strings.ToUpper(word) && len([]rune(word)) > 1 {
+		return strings.ToUpper(inflected)
+	}
+	if unicode.IsUpper([]rune(word)[0]) {
+		r := []rune(inflected)
+		r[0] = unicode.ToUpper(r[0])
+		return string(r)
+	}
+	return inflected
+}
+
+func hasAnySuffix(s string, suffixes ...string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(s, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func isVowel(r rune) bool {
+	return strings.ContainsRune("aeiou", r)
+}
@@ -0,0 +1,61 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflection(t *testing.T) {
+	cc := CopyCat{}
+	rendered, err := cc.renderContent(`{{ .name | plural }} {{ "people" | singular }}`, map[string]any{"name": "auth"})
+	require.NoError(t, err)
+	assert.Equal(t, "auths person", rendered)
+
+	tests := []struct {
+		singular string
+		plural   string
+	}{
+		{singular: "auth", plural: "auths"},
+		{singular: "invoice", plural: "invoices"},
+		{singular: "category", plural: "categories"},
+		{singular: "day", plural: "days"},
+		{singular: "box", plural: "boxes"},
+		{singular: "status", plural: "statuses"},
+		{singular: "address", plural: "addresses"},
+		{singular: "branch", plural: "branches"},
+		{singular: "analysis", plural: "analyses"},
+		{singular: "person", plural: "people"},
+		{singular: "child", plural: "children"},
+		{singular: "knife", plural: "knives"},
+		{singular: "index", plural: "indices"},
+		{singular: "sheep", plural: "sheep"},
+		{singular: "Person", plural: "People"},
+		{singular: "PERSON", plural: "PEOPLE"},
+		{singular: "OrderItem", plural: "OrderItems"},
+		{singular: "SalesPerson", plural: "SalesPeople"},
+		{singular: "order_category", plural: "order_categories"},
+		{singular: "human", plural: "humans"},
+		{singular: "house", plural: "houses"},
+		{singular: "promise", plural: "promises"},
+		{singular: "bus", plural: "buses"},
+		{singular: "movie", plural: "movies"},
+		{singular: "cookie", plural: "cookies"},
+		{singular: "pie", plural: "pies"},
+		{singular: "alias", plural: "aliases"},
+		{singular: "bias", plural: "biases"},
+		{singular: "database", plural: "databases"},
+		{singular: "schema", plural: "schemas"},
+		{singular: "idea", plural: "ideas"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.plural, plural(tt.singular), "plural(%q)", tt.singular)
+		assert.Equal(t, tt.singular, singular(tt.plural), "singular(%q)", tt.plural)
+	}
+
+	// already singular
+	for _, w := range []string{"alias", "status", "class", "analysis", "movie"} {
+		assert.Equal(t, w, singular(w), "singular(%q)", w)
+	}
+}
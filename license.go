@@ -0,0 +1,64 @@
+package copycat
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/quintans/faults"
+)
+
+// licenseFS holds the headers of common licenses, named by SPDX id, with <year> and <holder> placeholders
+//
+//go:embed licenses/*.txt
+var licenseFS embed.FS
+
+// license returns the header of a license by SPDX id, like Apache-2.0, with the year and holder filled
+// from the copyright.year and copyright.holder keys of the model, the year defaulting to the current one.
+// An optional prefix, like "// ", turns every line into a comment.
+//
+// Example: {{ license "Apache-2.0" "// " }}
+func (cc *CopyCat) license(id string, prefix ...string) (string, error) {
+	var data []byte
+	err := fs.ErrNotExist
+	if !strings.ContainsAny(id, `/\`) {
+		data, err = licenseFS.ReadFile(path.Join("licenses", id+".txt"))
+	}
+	if err != nil {
+		return "", faults.Errorf("unknown SPDX license id %q, use one of %s", id, strings.Join(licenseIDs(), ", "))
+	}
+
+	cc.trackKeys([]string{"copyright", "holder"})
+	cc.trackKeys([]string{"copyright", "year"})
+	holder := resolveKeyPathWithContext(cc.model, cc.model, []string{"copyright", "holder"})
+	if len(holder) == 0 || holder[0].result == nil {
+		return "", faults.Errorf("license %s needs the copyright.holder key in the model", id)
+	}
+	year := any(cc.now().Year())
+	if v := resolveKeyPathWithContext(cc.model, cc.model, []string{"copyright", "year"}); len(v) > 0 && v[0].result != nil {
+		year = v[0].result
+	}
+
+	text := strings.NewReplacer("<year>", fmt.Sprint(year), "<holder>", fmt.Sprint(holder[0].result)).Replace(string(data))
+	if len(prefix) == 0 || prefix[0] == "" {
+		return text, nil
+	}
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	for i, l := range lines {
+		// blank lines do not get trailing spaces
+		lines[i] = strings.TrimRight(prefix[0]+l, " ")
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// licenseIDs returns the SPDX ids of the embedded licenses, sorted
+func licenseIDs() []string {
+	entries, _ := licenseFS.ReadDir("licenses")
+	ids := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	return ids
+}
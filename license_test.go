@@ -0,0 +1,67 @@
+package copycat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLicense(t *testing.T) {
+	model := map[string]any{"copyright": map[string]any{"holder": "Acme Inc."}}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/main.go.tmpl", []byte("{{ license \"Apache-2.0\" \"// \" }}\npackage main\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/LICENSE.tmpl", []byte(`{{ license "MIT" }}`), 0o644))
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithFixedTime(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)))
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.Equal(t, `// Copyright 2024 Acme Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+`, string(files["main.go"]))
+	assert.Contains(t, string(files["LICENSE"]), "Copyright (c) 2024 Acme Inc.\n")
+	assert.Contains(t, string(files["LICENSE"]), "SPDX-License-Identifier: MIT\n")
+
+	// the year can come from the model
+	model["copyright"].(map[string]any)["year"] = "2019-2024"
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err = cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Contains(t, string(files["LICENSE"]), "Copyright (c) 2019-2024 Acme Inc.\n")
+}
+
+func TestLicenseErrors(t *testing.T) {
+	for content, msg := range map[string]string{
+		`{{ license "WTFPL" }}`:            `unknown SPDX license id "WTFPL", use one of Apache-2.0, BSD-3-Clause, GPL-3.0-or-later, MIT, MPL-2.0`,
+		`{{ license "../license" }}`:       `unknown SPDX license id "../license"`,
+		`{{ license "GPL-3.0-or-later" }}`: "license GPL-3.0-or-later needs the copyright.holder key in the model",
+	} {
+		inFS := afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(inFS, "template/LICENSE.tmpl", []byte(content), 0o644))
+		cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), map[string]any{})
+		require.NoError(t, err)
+		_, err = cc.RunToMap("template")
+		require.Error(t, err, content)
+		assert.Contains(t, err.Error(), msg, content)
+	}
+}
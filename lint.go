@@ -0,0 +1,161 @@
+package copycat
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// Warning is a potential problem found by LintTemplates
+type Warning struct {
+	// Path is the template file where the problem was found
+	Path string
+	// Field is the referenced model field, e.g. ".porjectName"
+	Field   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s: %s", w.Path, w.Field, w.Message)
+}
+
+// LintTemplates parses every template file under templatePath and warns about referenced fields that are absent from the model.
+//
+// Since the dot of a template depends on where it is rendered, fields relative to the dot, e.g. {{ .name.first }},
+// are only checked to exist somewhere in the model, while fields from the root, e.g. {{ root.owner.name }},
+// are checked against the full path. Dynamic accesses, like index, are not checked.
+func (cc *CopyCat) LintTemplates(templatePath string) ([]Warning, error) {
+	names, paths := modelKeys(cc.model)
+
+	var warnings []Warning
+	err := afero.Walk(cc.templateFS, templatePath, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if info.IsDir() || info.Name() == keepMarker || path == filepath.Join(templatePath, templateConfigFile) {
+			return nil
+		}
+		if cc.renderOnlySuffixed && !cc.parseFileName(info.Name()).isTemplate {
+			return nil
+		}
+
+		data, err := cc.readTemplate(path)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		t, err := template.New("lint").Funcs(cc.funcMap()).Parse(string(data))
+		if err != nil {
+			return faults.Wrapf(err, "parsing %s", path)
+		}
+
+		walkTemplate(t.Root, func(node parse.Node) {
+			switch n := node.(type) {
+			case *parse.FieldNode:
+				for _, key := range n.Ident {
+					if !names[key] {
+						warnings = append(warnings, Warning{
+							Path:    path,
+							Field:   n.String(),
+							Message: fmt.Sprintf("key %q is not defined in the model", key),
+						})
+						return
+					}
+				}
+			case *parse.ChainNode:
+				if isRootNode(n.Node) && !paths[strings.Join(n.Field, ".")] {
+					warnings = append(warnings, Warning{
+						Path:    path,
+						Field:   n.String(),
+						Message: fmt.Sprintf("path %q is not defined in the model", strings.Join(n.Field, ".")),
+					})
+				}
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return warnings, nil
+}
+
+// modelKeys returns all the key names of the model and all the key paths from the root.
+// Array elements are transparent, so features[0].name is known as features.name.
+func modelKeys(model map[string]any) (map[string]bool, map[string]bool) {
+	names := map[string]bool{}
+	paths := map[string]bool{}
+	var walk func(path string, value any)
+	walk = func(path string, value any) {
+		switch v := value.(type) {
+		case map[string]any:
+			for k, val := range v {
+				p := joinModelPath(path, k)
+				names[k] = true
+				paths[p] = true
+				walk(p, val)
+			}
+		case []any:
+			for _, item := range v {
+				walk(path, item)
+			}
+		}
+	}
+	walk("", model)
+	return names, paths
+}
+
+// walkTemplate visits all the nodes of a template tree
+func walkTemplate(node parse.Node, visit func(parse.Node)) {
+	if node == nil {
+		return
+	}
+	visit(node)
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkTemplate(c, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			walkTemplate(c, visit)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkTemplate(a, visit)
+		}
+	case *parse.ChainNode:
+		walkTemplate(n.Node, visit)
+	}
+}
+
+func walkBranch(n *parse.BranchNode, visit func(parse.Node)) {
+	walkTemplate(n.Pipe, visit)
+	if n.List != nil {
+		walkTemplate(n.List, visit)
+	}
+	if n.ElseList != nil {
+		walkTemplate(n.ElseList, visit)
+	}
+}
@@ -0,0 +1,51 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintTemplates(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/README.md", []byte("# {{ .porjectName }}\n{{ if .hasDb }}{{ .dbName }}{{ end }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ features.name }}/f.go.tmpl", []byte("package {{ .name }} // {{ (root).owner.nmae }} {{ root.owner.name }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"projectName": "App",
+		"hasDb":       false,
+		"features": []any{
+			map[string]any{"name": "auth"},
+		},
+		"owner": map[string]any{"name": "Alice"},
+	}
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+
+	warnings, err := cc.LintTemplates("template")
+	require.NoError(t, err)
+
+	var fields []string
+	for _, w := range warnings {
+		fields = append(fields, w.Field)
+	}
+	// .dbName is in a branch never taken, so rendering would not catch it
+	assert.ElementsMatch(t, []string{".porjectName", ".dbName", "(root).owner.nmae"}, fields)
+}
+
+func TestLintExamples(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewMemMapFs(), model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	warnings, err := cc.LintTemplates("examples/template")
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+}
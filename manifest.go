@@ -0,0 +1,143 @@
+package copycat
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// manifestFile is written at the output root, listing the files generated by the last run
+const manifestFile = ".copycat-manifest.json"
+
+// manifestEntry is a generated file, relative to the output root, and the template it came from,
+// relative to the template root
+type manifestEntry struct {
+	Path     string `json:"path"`
+	Template string `json:"template"`
+}
+
+type manifest struct {
+	Files []manifestEntry `json:"files"`
+}
+
+// WithManifest makes a run record the generated files in a .copycat-manifest.json file at the output root.
+// On the next run, files that a template generated before but no longer generates,
+// like the output of a renamed array element, are removed along with the directories left empty.
+func WithManifest() Option {
+	return func(cc *CopyCat) {
+		cc.manifest = true
+	}
+}
+
+// WithPrune removes, after a run, every file recorded in the manifest of the previous run that was not generated again,
+// even when its template is gone or excluded. It implies WithManifest. Files not in the manifest are never touched.
+func WithPrune() Option {
+	return func(cc *CopyCat) {
+		cc.manifest = true
+		cc.prune = true
+	}
+}
+
+// recordGenerated records a file written by the current run
+func (cc *CopyCat) recordGenerated(templateFile, outPath string) {
+	cc.run.generated = append(cc.run.generated, manifestEntry{
+		Path:     cc.relOutPath(outPath),
+		Template: cc.relTemplatePath(templateFile),
+	})
+}
+
+// loadManifest reads the manifest of the previous run. A missing manifest is an empty one.
+func (cc *CopyCat) loadManifest() (manifest, error) {
+	data, err := afero.ReadFile(cc.outputFS, filepath.Join(cc.run.outRoot, manifestFile))
+	if os.IsNotExist(err) {
+		return manifest{}, nil
+	}
+	if err != nil {
+		return manifest{}, faults.Wrap(err)
+	}
+
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return manifest{}, faults.Wrapf(err, "invalid manifest %s", manifestFile)
+	}
+	return m, nil
+}
+
+// writeManifest writes the files generated by the current run, removing the manifest if there are none
+func (cc *CopyCat) writeManifest() error {
+	name := filepath.Join(cc.run.outRoot, manifestFile)
+	if len(cc.run.generated) == 0 {
+		exists, err := afero.Exists(cc.outputFS, name)
+		if err != nil || !exists {
+			return faults.Wrap(err)
+		}
+		return faults.Wrap(cc.outputFS.Remove(name))
+	}
+
+	data, err := json.MarshalIndent(manifest{Files: cc.run.generated}, "", "  ")
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	return faults.Wrap(afero.WriteFile(cc.outputFS, name, append(data, '\n'), cc.outputFileMode()))
+}
+
+// removeOrphans removes the files of the previous run that were not generated again.
+// Unless pruning, only the files whose template still generates output, but no longer at that path, are removed.
+func (cc *CopyCat) removeOrphans(previous manifest) error {
+	generated := map[string]bool{}
+	templates := map[string]bool{}
+	for _, e := range cc.run.generated {
+		generated[e.Path] = true
+		templates[e.Template] = true
+	}
+
+	for _, e := range previous.Files {
+		if generated[e.Path] || (!cc.prune && !templates[e.Template]) {
+			continue
+		}
+		if err := cc.removeStale(e.Path); err != nil {
+			return faults.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// removeStale removes a previously generated file, relative to the output root,
+// and then its parent directories that were left empty
+func (cc *CopyCat) removeStale(rel string) error {
+	name := filepath.Join(cc.run.outRoot, filepath.FromSlash(rel))
+	// never touch anything outside the output directory, even with a tampered manifest
+	if !isWithinDir(cc.run.outRoot, name) || filepath.Clean(name) == filepath.Clean(cc.run.outRoot) {
+		return faults.Wrap(&PathEscapeError{Name: rel, Path: name})
+	}
+
+	exists, err := afero.Exists(cc.outputFS, name)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if !exists {
+		return nil
+	}
+	if err := cc.outputFS.Remove(name); err != nil {
+		return faults.Wrap(err)
+	}
+	cc.recordRemovedFile(name)
+
+	for dir := filepath.Dir(name); dir != filepath.Clean(cc.run.outRoot) && isWithinDir(cc.run.outRoot, dir); dir = filepath.Dir(dir) {
+		entries, err := afero.ReadDir(cc.outputFS, dir)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		if len(entries) > 0 {
+			break
+		}
+		if err := cc.outputFS.Remove(dir); err != nil {
+			return faults.Wrap(err)
+		}
+		cc.recordRemovedDir(dir)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestRemovesRenamedOutput(t *testing.T) {
+	templateFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(templateFS, "template/{{ features.name }}/{{ name }}.go.tmpl", []byte("package {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/README.md", []byte("readme\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	// a file not generated by copycat is never touched
+	require.NoError(t, afero.WriteFile(outFS, "out/auth/notes.txt", []byte("mine"), 0o644))
+
+	run := func(feature string) {
+		model := map[string]any{"features": []any{map[string]any{"name": feature}}}
+		cc, err := NewCopyCat(templateFS, outFS, model, WithManifest())
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false))
+	}
+
+	run("auth")
+	data, err := afero.ReadFile(outFS, "out/"+manifestFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"path": "auth/auth.go"`)
+	assert.Contains(t, string(data), `"template": "{{ features.name }}/{{ name }}.go.tmpl"`)
+
+	run("login")
+	exists, err := afero.Exists(outFS, "out/login/login.go")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = afero.Exists(outFS, "out/auth/auth.go")
+	require.NoError(t, err)
+	assert.False(t, exists, "renamed output should be removed")
+	exists, err = afero.Exists(outFS, "out/auth/notes.txt")
+	require.NoError(t, err)
+	assert.True(t, exists, "files not generated by copycat should be kept")
+
+	// once the directory has nothing left, it is removed too
+	require.NoError(t, outFS.Remove("out/auth/notes.txt"))
+	run("auth")
+	run("payments")
+	exists, err = afero.DirExists(outFS, "out/auth")
+	require.NoError(t, err)
+	assert.False(t, exists, "old feature directory should be cleaned up")
+	exists, err = afero.Exists(outFS, "out/README.md")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestPrune(t *testing.T) {
+	templateFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(templateFS, "template/main.go", []byte("package main\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/old/legacy.go", []byte("package old\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(templateFS, outFS, map[string]any{}, WithPrune())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	// the template of the stale file goes away and a user adds their own file
+	require.NoError(t, templateFS.RemoveAll("template/old"))
+	require.NoError(t, afero.WriteFile(outFS, "out/user.txt", []byte("mine"), 0o644))
+
+	require.NoError(t, cc.Run("template", "out", false))
+
+	exists, err := afero.Exists(outFS, "out/old/legacy.go")
+	require.NoError(t, err)
+	assert.False(t, exists, "stale generated file should be pruned")
+	exists, err = afero.DirExists(outFS, "out/old")
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = afero.Exists(outFS, "out/user.txt")
+	require.NoError(t, err)
+	assert.True(t, exists, "user file should survive")
+	exists, err = afero.Exists(outFS, "out/main.go")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestManifestKeepsOutputOfRemovedTemplate(t *testing.T) {
+	templateFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(templateFS, "template/main.go", []byte("package main\n"), 0o644))
+	require.NoError(t, afero.WriteFile(templateFS, "template/legacy.go", []byte("package main\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(templateFS, outFS, map[string]any{}, WithManifest())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	require.NoError(t, templateFS.Remove("template/legacy.go"))
+	require.NoError(t, cc.Run("template", "out", false))
+
+	// without pruning, only renamed outputs are removed
+	exists, err := afero.Exists(outFS, "out/legacy.go")
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,79 @@
+package copycat
+
+import (
+	"strings"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+const (
+	// MergeStartMarker flags the line after which the generated region of an existing file begins
+	MergeStartMarker = "copycat:start"
+	// MergeEndMarker flags the line where the generated region of an existing file ends
+	MergeEndMarker = "copycat:end"
+)
+
+// WithMergeRegions enables merging into existing output files.
+// When an output file already exists and has a line with MergeStartMarker followed by a line with MergeEndMarker,
+// only the lines in between are replaced by the rendered content, leaving the rest of the file intact.
+// The markers are usually placed in comments, e.g. "// copycat:start".
+// Files without the markers are overwritten as usual.
+func WithMergeRegions() Option {
+	return func(cc *CopyCat) {
+		cc.mergeRegions = true
+	}
+}
+
+// mergeExisting merges the content into the marked region of the existing output file, if any,
+// reporting whether it did.
+func (cc *CopyCat) mergeExisting(outPath, content string) (string, bool, error) {
+	if !cc.mergeRegions || cc.appending() {
+		return content, false, nil
+	}
+
+	exists, err := afero.Exists(cc.outputFS, outPath)
+	if err != nil {
+		return "", false, faults.Wrap(err)
+	}
+	if !exists {
+		return content, false, nil
+	}
+
+	existing, err := afero.ReadFile(cc.outputFS, outPath)
+	if err != nil {
+		return "", false, faults.Wrap(err)
+	}
+
+	if merged, ok := mergeRegion(string(existing), content); ok {
+		return merged, true, nil
+	}
+	return content, false, nil
+}
+
+// mergeRegion replaces the lines between the start and end marker lines with content.
+// It returns false if the markers are not found.
+func mergeRegion(existing, content string) (string, bool) {
+	start := strings.Index(existing, MergeStartMarker)
+	if start < 0 {
+		return "", false
+	}
+	startLineEnd := strings.IndexByte(existing[start:], '\n')
+	if startLineEnd < 0 {
+		return "", false
+	}
+	regionStart := start + startLineEnd + 1
+
+	end := strings.Index(existing[regionStart:], MergeEndMarker)
+	if end < 0 {
+		return "", false
+	}
+	// the region ends at the beginning of the end marker line
+	regionEnd := strings.LastIndexByte(existing[:regionStart+end], '\n') + 1
+
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	return existing[:regionStart] + content + existing[regionEnd:], true
+}
@@ -0,0 +1,95 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeRegions(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/routes.go.tmpl", []byte("{{ range .features }}\tregister(\"{{ .name }}\")\n{{ end }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/new.go.tmpl", []byte("package new\n"), 0o644)
+	require.NoError(t, err)
+
+	existing := `package routes
+
+// hand written
+func Routes() {
+	// copycat:start
+	register("old")
+	// copycat:end
+	custom()
+}
+`
+	err = afero.WriteFile(outFS, "out/routes.go", []byte(existing), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "auth"},
+			map[string]any{"name": "payments"},
+		},
+	}
+	cc, err := NewCopyCat(inFS, outFS, model, WithMergeRegions())
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/routes.go")
+	require.NoError(t, err)
+	assert.Equal(t, `package routes
+
+// hand written
+func Routes() {
+	// copycat:start
+	register("auth")
+	register("payments")
+	// copycat:end
+	custom()
+}
+`, string(data))
+
+	// files without markers are written as usual
+	data, err = afero.ReadFile(outFS, "out/new.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package new\n", string(data))
+}
+
+func TestMergeRegionsEmptyRender(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	outFS := afero.NewMemMapFs()
+
+	require.NoError(t, afero.WriteFile(inFS, "template/routes.go.tmpl", []byte("{{ range .features }}\tregister(\"{{ .name }}\")\n{{ end }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/other.go.tmpl", []byte("{{ range .features }}{{ .name }}{{ end }}"), 0o644))
+	require.NoError(t, afero.WriteFile(outFS, "out/routes.go", []byte("func Routes() {\n\t// copycat:start\n\tregister(\"old\")\n\t// copycat:end\n\tcustom()\n}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(outFS, "out/other.go", []byte("package other\n"), 0o644))
+
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"features": []any{}}, WithMergeRegions())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	// the region is cleared, keeping the hand written lines around it
+	data, err := afero.ReadFile(outFS, "out/routes.go")
+	require.NoError(t, err)
+	assert.Equal(t, "func Routes() {\n\t// copycat:start\n\t// copycat:end\n\tcustom()\n}\n", string(data))
+
+	// files without markers are still removed when rendering empty
+	exists, err := afero.Exists(outFS, "out/other.go")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestMergeRegionWithoutMarkers(t *testing.T) {
+	_, ok := mergeRegion("package main\n", "content")
+	assert.False(t, ok)
+
+	_, ok = mergeRegion("// copycat:start\nno end\n", "content")
+	assert.False(t, ok)
+}
@@ -0,0 +1,541 @@
+package copycat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/quintans/faults"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadModelDir reads all the .yaml, .yml and .json files of a directory, sorted by name, deep merging them into a single model.
+// The files of a subdirectory are merged under a key with the subdirectory name,
+// e.g. db/config.yaml is merged under the "db" key.
+func LoadModelDir(dir string, options ...LoadOption) (map[string]any, error) {
+	opts := newLoadOptions(options)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, faults.Wrap(&ModelLoadError{Path: dir, Err: err})
+	}
+
+	model := map[string]any{}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if entry.IsDir() {
+			sub, err := LoadModelDir(path, options...)
+			if err != nil {
+				return nil, faults.Wrap(err)
+			}
+			deepMerge(model, map[string]any{entry.Name(): sub})
+			continue
+		}
+
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+		default:
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, faults.Wrap(&ModelLoadError{Path: path, Err: err})
+		}
+		// JSON is valid YAML
+		fragment, err := opts.decode(data)
+		if err != nil {
+			return nil, faults.Wrap(&ModelLoadError{Path: path, Err: err})
+		}
+		deepMerge(model, normalizeModel(fragment))
+	}
+	return model, nil
+}
+
+// LoadOption configures how LoadModel and LoadModelDir decode the model files
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	tagResolvers map[string]func(node *yaml.Node) (any, error)
+}
+
+func newLoadOptions(options []LoadOption) loadOptions {
+	var opts loadOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	return opts
+}
+
+// WithYAMLTagResolver maps the custom YAML tags of the model files, like !secret, to values.
+// Each resolver gets the tagged node, whatever its kind, and returns the value replacing it.
+// Custom tags without a resolver fail the load, instead of being silently decoded as plain values.
+//
+// Example: WithYAMLTagResolver(map[string]func(*yaml.Node) (any, error){"!env": func(n *yaml.Node) (any, error) { return os.Getenv(n.Value), nil }})
+func WithYAMLTagResolver(resolvers map[string]func(node *yaml.Node) (any, error)) LoadOption {
+	return func(o *loadOptions) {
+		if o.tagResolvers == nil {
+			o.tagResolvers = map[string]func(node *yaml.Node) (any, error){}
+		}
+		maps.Copy(o.tagResolvers, resolvers)
+	}
+}
+
+// decode decodes a YAML document into a map, resolving its custom tags
+func (o loadOptions) decode(data []byte) (map[string]any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, faults.Wrap(err)
+	}
+	if err := o.resolveTags(&doc); err != nil {
+		return nil, faults.Wrap(err)
+	}
+
+	var model map[string]any
+	if err := doc.Decode(&model); err != nil {
+		return nil, faults.Wrap(err)
+	}
+	return model, nil
+}
+
+// resolveTags replaces the nodes with a custom tag by the value of their resolver.
+// Aliases are not followed, since their anchored node is resolved in place.
+func (o loadOptions) resolveTags(node *yaml.Node) error {
+	if isCustomTag(node.Tag) {
+		resolve, ok := o.tagResolvers[node.Tag]
+		if !ok {
+			return faults.Errorf("line %d: unknown YAML tag %s, register it with WithYAMLTagResolver", node.Line, node.Tag)
+		}
+		value, err := resolve(node)
+		if err != nil {
+			return faults.Wrapf(err, "line %d: resolving YAML tag %s", node.Line, node.Tag)
+		}
+		var resolved yaml.Node
+		if err := resolved.Encode(value); err != nil {
+			return faults.Wrapf(err, "line %d: encoding the value of YAML tag %s", node.Line, node.Tag)
+		}
+		// the anchor is kept, so that aliases get the resolved value
+		resolved.Anchor = node.Anchor
+		*node = resolved
+		return nil
+	}
+	if node.Kind == yaml.AliasNode {
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := o.resolveTags(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isCustomTag reports whether a node tag is an application tag, like !secret, and not a standard one, like !!str.
+// The decoder expands the standard tags to their full form, like tag:yaml.org,2002:str.
+func isCustomTag(tag string) bool {
+	return strings.HasPrefix(tag, "!") && tag != "!" && !strings.HasPrefix(tag, "!!")
+}
+
+// SetJSON merges a JSON value into the model at a dotted key path, from an assignment like features=[{"name":"auth"}]
+// or owner.email="alice@example.com", creating the missing maps along the path.
+// Like the files of LoadModelDir, objects are deep merged into the maps of the model, while any other value replaces the one there.
+// Whole numbers are decoded as int, like the ones of YAML models.
+func SetJSON(model map[string]any, assignment string) error {
+	keyPath, raw, ok := strings.Cut(assignment, "=")
+	keyPath = strings.TrimSpace(keyPath)
+	if !ok || keyPath == "" {
+		return faults.Errorf("invalid JSON assignment %q, expected key=value", assignment)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return faults.Errorf("invalid JSON for %s: %w", keyPath, err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return faults.Errorf("invalid JSON for %s: unexpected content after the value", keyPath)
+	}
+
+	keys := splitKeyPath(keyPath)
+	value = jsonNumbers(value)
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+	deepMerge(model, value.(map[string]any))
+	return nil
+}
+
+// jsonNumbers converts the numbers of a value decoded with UseNumber to int, when whole, or to float64
+func jsonNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return int(i)
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for k, val := range v {
+			v[k] = jsonNumbers(val)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = jsonNumbers(item)
+		}
+	}
+	return value
+}
+
+// normalizeModel returns a deep copy of a decoded YAML model made only of plain maps and slices,
+// so that the nodes resolved from anchors and merge keys (<<: *base) are never shared between keys,
+// and maps with non string keys become map[string]any, which is what path expansion navigates.
+func normalizeModel(model map[string]any) map[string]any {
+	return normalizeValue(model).(map[string]any)
+}
+
+func normalizeValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[k] = normalizeValue(val)
+		}
+		return m
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = normalizeValue(val)
+		}
+		return m
+	case []any:
+		arr := make([]any, len(v))
+		for i, item := range v {
+			arr[i] = normalizeValue(item)
+		}
+		return arr
+	default:
+		return v
+	}
+}
+
+// deepMerge merges src into dst. Nested maps are merged recursively, while any other value in src replaces the one in dst.
+func deepMerge(dst, src map[string]any) {
+	for k, sv := range src {
+		if sm, ok := sv.(map[string]any); ok {
+			if dm, ok := dst[k].(map[string]any); ok {
+				deepMerge(dm, sm)
+				continue
+			}
+		}
+		dst[k] = sv
+	}
+}
+
+// maxModelRenderPasses guards the model rendering against values that never settle
+const maxModelRenderPasses = 10
+
+// modelPasses tracks the passes of the model rendering
+type modelPasses struct {
+	// levels is, by model path of each template value, the length of the longest chain of template values it references
+	levels map[string]int
+	// pass is the current pass, from 0
+	pass int
+	// settled holds the template values whose rendering is final, kept as they are by the following passes
+	settled map[string]bool
+}
+
+// renderModel renders the string values of the model as templates, in passes,
+// so that derived values can depend on other derived values regardless of their order,
+// e.g. name -> slug -> path.
+// Every pass renders the values as declared, against the values rendered by the previous pass.
+// A value is rendered until the values it references are final, and then kept,
+// so that values that differ on every render, like {{ now }} or {{ randAlpha 8 }}, are rendered once.
+func (cc *CopyCat) renderModel(model map[string]any) (map[string]any, error) {
+	levels, err := cc.modelLevels(model)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	cc.modelPasses = &modelPasses{levels: levels, settled: map[string]bool{}}
+	defer func() { cc.modelPasses = nil }()
+
+	current := model
+	for pass := range maxModelRenderPasses {
+		cc.modelPasses.pass = pass
+		// root must see the values rendered so far
+		cc.model = current
+		m, err := cc.renderModelValue("", current, model)
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+		// if it fails casting, something is very wrong
+		current = m.(map[string]any)
+		if len(cc.modelPasses.settled) == len(levels) {
+			return current, nil
+		}
+	}
+	return nil, faults.Errorf("model rendering did not settle after %d passes", maxModelRenderPasses)
+}
+
+// renderModelChild renders a value of a model node, unless it is already settled.
+// parent and child are the node and the value as rendered by the previous pass.
+func (cc *CopyCat) renderModelChild(path string, parent, child, value any) (any, error) {
+	passes := cc.modelPasses
+	if passes != nil && passes.settled[path] {
+		return child, nil
+	}
+	rendered, err := cc.renderModelValue(path, childDot(parent, child, value), value)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	if passes == nil {
+		return rendered, nil
+	}
+	if level, ok := passes.levels[path]; ok && level <= passes.pass {
+		// a value still rendering to a new template read another one before it was rendered,
+		// through a reference that is not a simple field access, like in a range
+		if s, _ := rendered.(string); !strings.Contains(s, "{{") || s == child {
+			passes.settled[path] = true
+		}
+	}
+	return rendered, nil
+}
+
+// modelLevels returns, by model path of each template value, the length of the longest chain of template values it references,
+// 0 for the ones that do not reference any. A value at level n is final after n+1 passes.
+func (cc *CopyCat) modelLevels(model map[string]any) (map[string]int, error) {
+	paths, edges, err := cc.modelGraph(model)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	levels := make(map[string]int, len(paths))
+	var level func(p string) int
+	level = func(p string) int {
+		if l, ok := levels[p]; ok {
+			return l
+		}
+		// guards against cycles, which checkModelCycles reports
+		levels[p] = 0
+		l := 0
+		for _, next := range edges[p] {
+			l = max(l, level(next)+1)
+		}
+		levels[p] = l
+		return l
+	}
+	for _, p := range paths {
+		level(p)
+	}
+	return levels, nil
+}
+
+// modelRef is a string value of the model that is a template, along with the model paths it references
+type modelRef struct {
+	path string
+	refs []string
+}
+
+// checkModelCycles statically inspects the string values of the model that are templates
+// and returns an error if they reference each other in a cycle, e.g. a: "{{ .b }}" and b: "{{ .a }}".
+//
+// References are only followed when they are simple field accesses relative to the enclosing object
+// ({{ .b }}) or to the root ({{ root.b }}). Fields accessed inside range/with blocks are ignored,
+// since the dot is no longer the enclosing object.
+func (cc *CopyCat) checkModelCycles(model map[string]any) error {
+	paths, edges, err := cc.modelGraph(model)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(paths))
+	var stack []string
+	var visit func(p string) error
+	visit = func(p string) error {
+		state[p] = visiting
+		stack = append(stack, p)
+		for _, next := range edges[p] {
+			switch state[next] {
+			case visiting:
+				cycle := append(slices.Clone(stack[slices.Index(stack, next):]), next)
+				return faults.Errorf("cyclic model reference: %s", strings.Join(cycle, " -> "))
+			case unvisited:
+				if err := visit(next); err != nil {
+					return err
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[p] = visited
+		return nil
+	}
+
+	for _, p := range paths {
+		if state[p] == unvisited {
+			if err := visit(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// modelGraph returns the paths of the string values of the model that are templates,
+// and the template values each one references
+func (cc *CopyCat) modelGraph(model map[string]any) ([]string, map[string][]string, error) {
+	var nodes []modelRef
+	if err := cc.collectModelRefs("", model, &nodes); err != nil {
+		return nil, nil, faults.Wrap(err)
+	}
+
+	paths := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		paths = append(paths, n.path)
+	}
+
+	// resolve each reference to the template values it may reach
+	edges := make(map[string][]string, len(nodes))
+	for _, n := range nodes {
+		for _, ref := range n.refs {
+			for _, p := range paths {
+				if p == ref || strings.HasPrefix(p, ref+".") || strings.HasPrefix(p, ref+"[") {
+					edges[n.path] = append(edges[n.path], p)
+				}
+			}
+		}
+	}
+	return paths, edges, nil
+}
+
+// collectModelRefs walks the model collecting the template values and the paths they reference
+func (cc *CopyCat) collectModelRefs(path string, value any, nodes *[]modelRef) error {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") || cc.isRawModelKey(path) {
+			return nil
+		}
+		t, err := template.New("model").Funcs(cc.funcMap()).Parse(v)
+		if err != nil {
+			return faults.Wrapf(err, "parsing model value %s", path)
+		}
+		parent := ""
+		if i := strings.LastIndexAny(path, ".["); i >= 0 {
+			parent = path[:i]
+		}
+		var refs []string
+		collectTreeRefs(t.Root, parent, &refs)
+		*nodes = append(*nodes, modelRef{path: path, refs: refs})
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		for _, k := range keys {
+			if err := cc.collectModelRefs(joinModelPath(path, k), v[k], nodes); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for i, item := range v {
+			if err := cc.collectModelRefs(fmt.Sprintf("%s[%d]", path, i), item, nodes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// collectTreeRefs gathers the model paths referenced by the template node.
+// dotPath is the model path of the dot.
+func collectTreeRefs(node parse.Node, dotPath string, refs *[]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectTreeRefs(c, dotPath, refs)
+		}
+	case *parse.ActionNode:
+		collectTreeRefs(n.Pipe, dotPath, refs)
+	case *parse.IfNode:
+		collectTreeRefs(n.Pipe, dotPath, refs)
+		collectTreeRefs(n.List, dotPath, refs)
+		collectTreeRefs(n.ElseList, dotPath, refs)
+	case *parse.RangeNode:
+		// the dot changes inside the body, so only the pipeline is relevant
+		collectTreeRefs(n.Pipe, dotPath, refs)
+	case *parse.WithNode:
+		collectTreeRefs(n.Pipe, dotPath, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			collectTreeRefs(c, dotPath, refs)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			collectTreeRefs(a, dotPath, refs)
+		}
+	case *parse.FieldNode:
+		*refs = append(*refs, joinModelPath(dotPath, n.Ident...))
+	case *parse.ChainNode:
+		if isRootNode(n.Node) {
+			*refs = append(*refs, joinModelPath("", n.Field...))
+			return
+		}
+		collectTreeRefs(n.Node, dotPath, refs)
+	}
+}
+
+// isRootNode reports whether the node is a call to the root helper, either as root or (root)
+func isRootNode(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.IdentifierNode:
+		return n.Ident == "root"
+	case *parse.PipeNode:
+		if len(n.Cmds) == 1 && len(n.Cmds[0].Args) == 1 {
+			return isRootNode(n.Cmds[0].Args[0])
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 1 {
+			return isRootNode(n.Args[0])
+		}
+	}
+	return false
+}
+
+// arrayIndex matches the array indexes of a model path, like [0] in features[0].name
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// isRawModelKey reports whether the value at the model path is excluded from model rendering
+func (cc *CopyCat) isRawModelKey(path string) bool {
+	if len(cc.rawModelKeys) == 0 {
+		return false
+	}
+	return slices.Contains(cc.rawModelKeys, arrayIndex.ReplaceAllString(path, ""))
+}
+
+func joinModelPath(base string, keys ...string) string {
+	if base == "" {
+		return strings.Join(keys, ".")
+	}
+	if len(keys) == 0 {
+		return base
+	}
+	return base + "." + strings.Join(keys, ".")
+}
@@ -0,0 +1,284 @@
+package copycat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestModelCyclicReference(t *testing.T) {
+	model := map[string]any{
+		"a": "{{ .b }}",
+		"b": "{{ .a }}",
+	}
+
+	_, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic model reference: a -> b -> a")
+}
+
+func TestModelCyclicReferenceThroughRoot(t *testing.T) {
+	model := map[string]any{
+		"projectName": "{{ (root).owner.name }}",
+		"owner": map[string]any{
+			"name": "{{ root.projectName | lower }}",
+		},
+	}
+
+	_, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "cyclic model reference: owner.name -> projectName -> owner.name")
+}
+
+func TestModelWithoutCycles(t *testing.T) {
+	model := map[string]any{
+		"projectName": "My App",
+		"projectSlug": `{{ lower .projectName | replace " " "_" }}`,
+		"owner": map[string]any{
+			"name": "{{ (root).projectName }} team",
+		},
+	}
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	assert.Equal(t, "my_app", cc.model["projectSlug"])
+}
+
+func TestModelDerivedChain(t *testing.T) {
+	model := map[string]any{
+		// declared in reverse dependency order on purpose
+		"path": "src/{{ .slug }}",
+		"slug": `{{ .name | lower | replace " " "-" }}`,
+		"name": "My App",
+		"owner": map[string]any{
+			"home": "{{ (root).path }}/owner",
+		},
+	}
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	assert.Equal(t, "My App", cc.model["name"])
+	assert.Equal(t, "my-app", cc.model["slug"])
+	assert.Equal(t, "src/my-app", cc.model["path"])
+	assert.Equal(t, "src/my-app/owner", cc.model["owner"].(map[string]any)["home"])
+}
+
+func TestLoadModelDir(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"01-project.yaml": "projectName: My App\nowner:\n  name: Alice\n",
+		"02-features.yml": "features:\n  - name: auth\nowner:\n  email: alice@example.com\n",
+		"03-extra.json":   `{"hasDb": true}`,
+		"notes.txt":       "ignored",
+		"db/config.yaml":  "host: localhost\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	model, err := LoadModelDir(dir)
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"projectName": "My App",
+		"owner": map[string]any{
+			"name":  "Alice",
+			"email": "alice@example.com",
+		},
+		"features": []any{
+			map[string]any{"name": "auth"},
+		},
+		"hasDb": true,
+		"db": map[string]any{
+			"host": "localhost",
+		},
+	}, model)
+}
+
+func TestYAMLTagResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "model.yaml")
+	content := "name: !upper shop\nowner: &owner\n  name: !upper alice\nreviewer: *owner\nports: !ports 8080\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	resolvers := map[string]func(*yaml.Node) (any, error){
+		"!upper": func(n *yaml.Node) (any, error) { return strings.ToUpper(n.Value), nil },
+		"!ports": func(n *yaml.Node) (any, error) { return []any{n.Value, "9090"}, nil },
+	}
+	model, err := LoadModel(path, WithYAMLTagResolver(resolvers))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"name":     "SHOP",
+		"owner":    map[string]any{"name": "ALICE"},
+		"reviewer": map[string]any{"name": "ALICE"},
+		"ports":    []any{"8080", "9090"},
+	}, model)
+
+	// unknown custom tags are an error
+	_, err = LoadModel(path, WithYAMLTagResolver(map[string]func(*yaml.Node) (any, error){"!upper": resolvers["!upper"]}))
+	assert.ErrorIs(t, err, ErrModelLoad)
+	assert.ErrorContains(t, err, "line 5: unknown YAML tag !ports")
+
+	// standard tags are not custom
+	require.NoError(t, os.WriteFile(path, []byte("port: !!str 8080\n"), 0o644))
+	model, err = LoadModel(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"port": "8080"}, model)
+}
+
+func TestSetJSON(t *testing.T) {
+	model := map[string]any{
+		"projectName": "shop",
+		"owner":       map[string]any{"name": "Alice"},
+		"features":    []any{map[string]any{"name": "old"}},
+	}
+	require.NoError(t, SetJSON(model, `features=[{"name":"auth","port":8080},{"name":"billing","ratio":0.5}]`))
+	require.NoError(t, SetJSON(model, `owner.email="alice@example.com"`))
+	require.NoError(t, SetJSON(model, `db.replicas=2`))
+
+	assert.Equal(t, map[string]any{
+		"projectName": "shop",
+		"owner":       map[string]any{"name": "Alice", "email": "alice@example.com"},
+		"features": []any{
+			map[string]any{"name": "auth", "port": 8080},
+			map[string]any{"name": "billing", "ratio": 0.5},
+		},
+		"db": map[string]any{"replicas": 2},
+	}, model)
+
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}.txt", []byte("{{ .name }}"), 0o644))
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"auth.txt": []byte("auth"), "billing.txt": []byte("billing")}, files)
+
+	for _, assignment := range []string{`features=[{"name":`, `name=shop`, `features`, `=1`, `name="a" "b"`} {
+		assert.Error(t, SetJSON(model, assignment), assignment)
+	}
+	assert.ErrorContains(t, SetJSON(model, `name=shop`), "invalid JSON for name")
+}
+
+func TestLoadModelAnchorsAndMergeKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "model.yaml")
+	content := `
+defaults: &defaults
+  enabled: true
+  table: default_table
+  owner: &owner
+    name: Alice
+features:
+  - <<: *defaults
+    name: auth
+  - name: billing
+    table: invoices
+    <<: *defaults
+codes:
+  1: one
+  2: two
+`
+	require.NoError(t, os.WriteFile(file, []byte(content), 0o644))
+
+	model, err := LoadModel(file)
+	require.NoError(t, err)
+
+	features := model["features"].([]any)
+	auth := features[0].(map[string]any)
+	billing := features[1].(map[string]any)
+
+	assert.Equal(t, "auth", auth["name"])
+	assert.Equal(t, true, auth["enabled"])
+	assert.Equal(t, "default_table", auth["table"])
+	assert.Equal(t, map[string]any{"name": "Alice"}, auth["owner"])
+
+	assert.Equal(t, "billing", billing["name"])
+	assert.Equal(t, true, billing["enabled"])
+	assert.Equal(t, "invoices", billing["table"], "explicit keys win over merged ones, regardless of order")
+
+	// merged nodes are not shared
+	auth["owner"].(map[string]any)["name"] = "Bob"
+	assert.Equal(t, "Alice", billing["owner"].(map[string]any)["name"])
+
+	assert.Equal(t, map[string]any{"1": "one", "2": "two"}, model["codes"])
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	names, err := cc.ExpandName("{{ features.table }}", model)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"default_table", "invoices"}, names)
+}
+
+func TestRawModelKeys(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	err := afero.WriteFile(inFS, "template/{{ features.name }}.txt", []byte("{{ tpl .header . }}\nraw: {{ .header }}\n"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"projectName": "Shop",
+		"features": []any{
+			map[string]any{"name": "auth", "header": "{{ .name }} of {{ root.projectName }}"},
+			map[string]any{"name": "cart", "header": "{{ .name }} of {{ root.projectName }}"},
+		},
+		"title": "{{ .projectName }}",
+	}
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, model, WithRawModelKeys("features.header"))
+	require.NoError(t, err)
+	assert.Equal(t, "Shop", cc.model["title"], "other values are still rendered")
+
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err := afero.ReadFile(outFS, "out/auth.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "auth of Shop\nraw: {{ .name }} of {{ root.projectName }}\n", string(data))
+	data, err = afero.ReadFile(outFS, "out/cart.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "cart of Shop\nraw: {{ .name }} of {{ root.projectName }}\n", string(data))
+}
+
+func TestDefaults(t *testing.T) {
+	defaults := map[string]any{
+		"owner":   map[string]any{"name": "Platform Team", "email": "platform@example.com"},
+		"license": "MIT",
+	}
+	model := map[string]any{
+		"owner":   map[string]any{"email": "dev@acme.com"},
+		"license": "Apache-2.0",
+	}
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model, WithDefaults(defaults))
+	require.NoError(t, err)
+
+	out, err := cc.Render("{{ .owner.name }} <{{ .owner.email }}> {{ .license }}", cc.model)
+	require.NoError(t, err)
+	assert.Equal(t, "Platform Team <dev@acme.com> Apache-2.0", out)
+
+	// neither the defaults nor the model are changed
+	assert.Equal(t, map[string]any{"email": "dev@acme.com"}, model["owner"])
+	assert.Equal(t, "Platform Team", defaults["owner"].(map[string]any)["name"])
+}
+
+func TestModelValuesRenderedOnce(t *testing.T) {
+	model := map[string]any{
+		"secret": "{{ randAlpha 8 }}",
+		"built":  "{{ now }}",
+		// a reference sees the value as rendered once
+		"dsn": "postgres://app:{{ .secret }}@db",
+	}
+
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	secret := cc.model["secret"].(string)
+	assert.Len(t, secret, 8)
+	assert.Equal(t, "postgres://app:"+secret+"@db", cc.model["dsn"])
+	assert.NotEmpty(t, cc.model["built"])
+}
@@ -0,0 +1,136 @@
+package copycat
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// Planned actions reported by a dry run
+const (
+	ActionDir  = "dir"
+	ActionFile = "file"
+	ActionSkip = "skip"
+	// ActionRemove is a file or directory that a run would remove, like a previous output that now renders empty
+	ActionRemove = "remove"
+)
+
+// PlannedAction is an action that a dry run would perform
+type PlannedAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Bytes  int    `json:"bytes"`
+}
+
+// WithPlanOutput makes a dry run write the planned actions to w as a JSON array,
+// instead of the human readable lines.
+func WithPlanOutput(w io.Writer) Option {
+	return func(cc *CopyCat) {
+		cc.planOutput = w
+	}
+}
+
+// WithOutput writes the informational output, like the lines of a dry run, to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(cc *CopyCat) {
+		cc.output = w
+	}
+}
+
+// WithQuiet suppresses the informational output printed to stdout, like the lines of a dry run.
+// A plan output set with WithPlanOutput is still written.
+func WithQuiet() Option {
+	return func(cc *CopyCat) {
+		cc.quiet = true
+	}
+}
+
+// reportPlanned reports an action of a dry run
+func (cc *CopyCat) reportPlanned(action, path string, bytes int) {
+	switch action {
+	case ActionDir, ActionFile:
+		cc.run.planned++
+	case ActionRemove:
+		if cc.run.plannedRemovals == nil {
+			cc.run.plannedRemovals = map[string]bool{}
+		}
+		cc.run.plannedRemovals[path] = true
+	}
+
+	if cc.planOutput != nil {
+		cc.run.plan = append(cc.run.plan, PlannedAction{Action: action, Path: path, Bytes: bytes})
+		return
+	}
+	if cc.quiet {
+		return
+	}
+
+	switch action {
+	case ActionDir:
+		fmt.Fprintf(cc.out(), "[DIR]  %s\n", path)
+	case ActionSkip:
+		fmt.Fprintf(cc.out(), "[SKIP] %s (empty after rendering)\n", path)
+	case ActionRemove:
+		fmt.Fprintf(cc.out(), "[REMOVE] %s\n", path)
+	default:
+		fmt.Fprintf(cc.out(), "[FILE] %s (%d bytes)\n", path, bytes)
+	}
+}
+
+// out returns the writer of the informational output, stdout by default
+func (cc *CopyCat) out() io.Writer {
+	if cc.output != nil {
+		return cc.output
+	}
+	return os.Stdout
+}
+
+// planRemoveIfEmpty reports the removal of a directory that a run would leave empty,
+// given the count of planned outputs after the directory itself was planned.
+// Like a run, a directory that would be created is reported and then removed.
+func (cc *CopyCat) planRemoveIfEmpty(dir string, planned int) error {
+	if cc.run.planned > planned {
+		return nil
+	}
+
+	exists, err := afero.DirExists(cc.outputFS, dir)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if exists {
+		entries, err := afero.ReadDir(cc.outputFS, dir)
+		if err != nil {
+			return faults.Wrap(err)
+		}
+		for _, e := range entries {
+			if !cc.run.plannedRemovals[filepath.Join(dir, e.Name())] {
+				return nil
+			}
+		}
+	}
+
+	cc.reportPlanned(ActionRemove, dir, 0)
+	// the directory no longer counts as an output of the run
+	cc.run.planned--
+	return nil
+}
+
+// writePlan writes the collected planned actions, if a plan output is configured
+func (cc *CopyCat) writePlan() error {
+	if cc.planOutput == nil {
+		return nil
+	}
+
+	plan := cc.run.plan
+	if plan == nil {
+		plan = []PlannedAction{}
+	}
+	enc := json.NewEncoder(cc.planOutput)
+	enc.SetIndent("", "  ")
+	return faults.Wrap(enc.Encode(plan))
+}
@@ -0,0 +1,140 @@
+package copycat
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanOutput(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	var buf bytes.Buffer
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(
+		afero.NewOsFs(),
+		outFS,
+		model,
+		WithCustomFuncs(customFuncs),
+		WithPlanOutput(&buf),
+	)
+	require.NoError(t, err)
+
+	err = cc.Run("examples/template", "", true)
+	require.NoError(t, err)
+
+	var plan []PlannedAction
+	err = json.Unmarshal(buf.Bytes(), &plan)
+	require.NoError(t, err, "plan should be valid JSON")
+
+	actions := map[string]string{}
+	for _, a := range plan {
+		actions[a.Path] = a.Action
+		if a.Action == ActionFile {
+			assert.Positive(t, a.Bytes, "file %s should have a size", a.Path)
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"my_app":                      ActionDir,
+		"my_app/README.md":            ActionFile,
+		"my_app/empty.txt":            ActionSkip,
+		"my_app/gateway":              ActionRemove, // planned and then pruned, since it ends up empty
+		"my_app/gateway/db.go":        ActionSkip,
+		"my_app/auth":                 ActionDir,
+		"my_app/auth/config.txt":      ActionFile,
+		"my_app/auth/auth.go":         ActionFile,
+		"my_app/payments":             ActionDir,
+		"my_app/payments/config.txt":  ActionFile,
+		"my_app/payments/payments.go": ActionFile,
+	}, actions)
+
+	files, err := afero.ReadDir(outFS, "")
+	require.NoError(t, err)
+	assert.Empty(t, files, "no files should be created in dry-run mode")
+}
+
+func TestQuietDryRun(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewMemMapFs(), model, WithCustomFuncs(customFuncs), WithQuiet())
+	require.NoError(t, err)
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	err = cc.Run("examples/template", "", true)
+	os.Stdout = stdout
+	require.NoError(t, w.Close())
+	require.NoError(t, err)
+
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, string(out))
+}
+
+func TestDryRunOutput(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("# {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/db.go.tmpl", []byte("{{ if .db }}package db{{ end }}"), 0o644))
+	model := map[string]any{
+		"name":     "app",
+		"features": []any{map[string]any{"name": "auth", "db": true}},
+	}
+
+	var out bytes.Buffer
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithOutput(&out))
+	require.NoError(t, err)
+
+	require.NoError(t, cc.Run("template", "out", true))
+	assert.Equal(t, `[FILE] out/README.md (6 bytes)
+[DIR]  out/auth
+[FILE] out/auth/db.go (10 bytes)
+`, out.String())
+
+	// quiet still wins
+	out.Reset()
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model, WithOutput(&out), WithQuiet())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", true))
+	assert.Empty(t, out.String())
+}
+
+func TestDryRunReportsRemovals(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("# {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/docs/notes.txt.tmpl", []byte("{{ if .notes }}notes{{ end }}"), 0o644))
+
+	// a previous run generated the notes
+	outFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(outFS, "out/docs/notes.txt", []byte("notes"), 0o644))
+
+	var out bytes.Buffer
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"name": "app", "notes": false}, WithOutput(&out))
+	require.NoError(t, err)
+
+	require.NoError(t, cc.Run("template", "out", true))
+	assert.Equal(t, `[FILE] out/README.md (6 bytes)
+[DIR]  out/docs
+[REMOVE] out/docs/notes.txt
+[REMOVE] out/docs
+`, out.String())
+
+	// nothing is touched
+	exists, err := afero.Exists(outFS, "out/docs/notes.txt")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// the preview matches what a real run does
+	require.NoError(t, cc.Run("template", "out", false))
+	assert.Equal(t, []string{"docs/notes.txt"}, cc.Result().RemovedFiles)
+	assert.Equal(t, []string{"docs"}, cc.Result().RemovedDirs)
+}
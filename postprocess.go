@@ -0,0 +1,124 @@
+package copycat
+
+import (
+	"regexp"
+	"strings"
+)
+
+// TrailingNewline controls how the end of the rendered text output is normalized
+type TrailingNewline int
+
+const (
+	// TrailingNewlineKeep leaves the rendered content untouched
+	TrailingNewlineKeep TrailingNewline = iota
+	// TrailingNewlineTrim removes any trailing whitespace
+	TrailingNewlineTrim
+	// TrailingNewlineSingle removes any trailing whitespace and ends the content with exactly one newline
+	TrailingNewlineSingle
+)
+
+// WithTrailingNewline sets how trailing whitespace of rendered text files is normalized.
+// Binary content is never touched.
+func WithTrailingNewline(mode TrailingNewline) Option {
+	return func(cc *CopyCat) {
+		cc.trailingNewline = mode
+	}
+}
+
+// WithCollapseBlankLines collapses, after rendering, the runs of blank lines left by lines holding only template actions,
+// like {{ if }} and {{ end }}, into at most one blank line. Blank lines written in the template are left untouched.
+func WithCollapseBlankLines() Option {
+	return func(cc *CopyCat) {
+		cc.collapseBlankLines = true
+	}
+}
+
+// actionLineMark is appended to the template lines holding only actions, to tell the blank lines they render to.
+// It is a Unicode noncharacter, reserved for internal use, so it does not clash with the template content.
+const actionLineMark = "\uFDD0"
+
+// actionLine matches a line holding only template actions
+var actionLine = regexp.MustCompile(`^\s*(\{\{.*?\}\}\s*)+$`)
+
+// markActionLines appends actionLineMark to the lines of a template source holding only actions.
+// Lines ending with a right trim marker, -}}, are not marked since the mark would stop the trimming.
+func markActionLines(source string) string {
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		if !actionLine.MatchString(line) || strings.HasSuffix(strings.TrimRight(line, " \t\r"), "-}}") {
+			continue
+		}
+		end := strings.LastIndex(line, "}}") + len("}}")
+		lines[i] = line[:end] + actionLineMark + line[end:]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// collapseBlankLines removes the marks added by markActionLines, collapsing the runs of blank lines that have
+// blank lines rendered from marked lines. Such a run keeps its unmarked blank lines, or a single blank line if there are none.
+func collapseBlankLines(content string) string {
+	if isBinary(content) {
+		return strings.ReplaceAll(content, actionLineMark, "")
+	}
+
+	body, newline := strings.CutSuffix(content, "\n")
+	var out []string
+	var run []string
+	marked := false
+	flush := func() {
+		if marked && len(run) == 0 {
+			run = []string{""}
+		}
+		out = append(out, run...)
+		run = nil
+		marked = false
+	}
+	for _, line := range strings.Split(body, "\n") {
+		isMarked := strings.Contains(line, actionLineMark)
+		line = strings.ReplaceAll(line, actionLineMark, "")
+		if strings.TrimSpace(line) != "" {
+			flush()
+			out = append(out, line)
+			continue
+		}
+		if isMarked {
+			marked = true
+			continue
+		}
+		run = append(run, line)
+	}
+	flush()
+
+	content = strings.Join(out, "\n")
+	if newline {
+		content += "\n"
+	}
+	return content
+}
+
+// postProcess applies the configured normalizations to the rendered content of a file
+func (cc *CopyCat) postProcess(content string) string {
+	if cc.collapseBlankLines {
+		content = collapseBlankLines(content)
+	}
+	if isBinary(content) {
+		return content
+	}
+
+	switch cc.trailingNewline {
+	case TrailingNewlineTrim:
+		content = strings.TrimRight(content, " \t\r\n")
+	case TrailingNewlineSingle:
+		content = strings.TrimRight(content, " \t\r\n")
+		if content != "" {
+			content += "\n"
+		}
+	}
+
+	return content
+}
+
+// isBinary uses the presence of a NUL byte as a heuristic for binary content
+func isBinary(content string) bool {
+	return strings.IndexByte(content, 0) >= 0
+}
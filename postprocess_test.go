@@ -0,0 +1,92 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrailingNewline(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := "package main\n{{ if .debug }}\nconst debug = true\n{{ end }}\n\n  \n"
+	err := afero.WriteFile(inFS, "template/main.go.tmpl", []byte(template), 0o644)
+	require.NoError(t, err)
+
+	tests := []struct {
+		mode     TrailingNewline
+		expected string
+	}{
+		{mode: TrailingNewlineKeep, expected: "package main\n\n\n  \n"},
+		{mode: TrailingNewlineTrim, expected: "package main"},
+		{mode: TrailingNewlineSingle, expected: "package main\n"},
+	}
+
+	for _, tt := range tests {
+		outFS := afero.NewMemMapFs()
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{"debug": false}, WithTrailingNewline(tt.mode))
+		require.NoError(t, err)
+
+		err = cc.Run("template", "out", false)
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(outFS, "out/main.go")
+		require.NoError(t, err)
+		assert.Equal(t, tt.expected, string(data), "mode %d", tt.mode)
+	}
+}
+
+func TestTrailingNewlineSkipsBinary(t *testing.T) {
+	cc := CopyCat{trailingNewline: TrailingNewlineSingle}
+	content := "\x00\x01\n\n"
+	assert.Equal(t, content, cc.postProcess(content))
+}
+
+func TestCollapseBlankLines(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := `services:
+{{ if .db }}
+  db:
+    image: postgres
+{{ end }}
+{{ if .cache }}
+  cache:
+    image: redis
+{{ end }}
+{{ if .queue }}
+  queue:
+    image: rabbitmq
+{{ end }}
+
+
+  app:
+    image: {{ .image }}
+    {{ if .debug }}debug: true{{ end }}
+`
+	err := afero.WriteFile(inFS, "template/compose.yaml.tmpl", []byte(template), 0o644)
+	require.NoError(t, err)
+
+	outFS := afero.NewMemMapFs()
+	model := map[string]any{"db": true, "cache": false, "queue": false, "debug": false, "image": "app:latest"}
+	cc, err := NewCopyCat(inFS, outFS, model, WithCollapseBlankLines())
+	require.NoError(t, err)
+
+	err = cc.Run("template", "out", false)
+	require.NoError(t, err)
+
+	data, err := afero.ReadFile(outFS, "out/compose.yaml")
+	require.NoError(t, err)
+	// the double blank line written in the template is kept as is
+	expected := `services:
+
+  db:
+    image: postgres
+
+
+  app:
+    image: app:latest
+
+`
+	assert.Equal(t, expected, string(data))
+}
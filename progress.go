@@ -0,0 +1,48 @@
+package copycat
+
+import (
+	"github.com/quintans/faults"
+)
+
+// WithProgress sets a callback invoked as each output entry, file or directory, is handled.
+// done is the number of entries handled so far, including the current one, out of total.
+// The total is computed by walking the template tree once before the run.
+func WithProgress(fn func(done, total int, path string)) Option {
+	return func(cc *CopyCat) {
+		cc.progress = fn
+	}
+}
+
+// reportProgress reports the handling of an output entry to the progress callback
+func (cc *CopyCat) reportProgress(path string) {
+	if cc.progress == nil {
+		return
+	}
+	cc.run.done++
+	cc.progress(cc.run.done, cc.run.total, path)
+}
+
+// countEntries counts the output entries that processDir will handle
+func (cc *CopyCat) countEntries(currentTemplatePath string, currentOutPath string, frames []contextFrame) (int, error) {
+	items, err := cc.listEntries(currentTemplatePath, currentOutPath, frames)
+	if err != nil {
+		return 0, faults.Wrap(err)
+	}
+
+	count := len(items)
+	for _, item := range items {
+		if !item.isDir {
+			continue
+		}
+		if item.outPath == currentOutPath {
+			// directories that only rebind the context are not reported
+			count--
+		}
+		n, err := cc.countEntries(item.templatePath, item.outPath, item.frames)
+		if err != nil {
+			return 0, faults.Wrap(err)
+		}
+		count += n
+	}
+	return count, nil
+}
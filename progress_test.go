@@ -0,0 +1,76 @@
+package copycat
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgress(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	var dones []int
+	var paths []string
+	total := -1
+	cc, err := NewCopyCat(
+		afero.NewOsFs(),
+		afero.NewMemMapFs(),
+		model,
+		WithCustomFuncs(customFuncs),
+		WithProgress(func(done, tot int, path string) {
+			dones = append(dones, done)
+			paths = append(paths, path)
+			if total >= 0 {
+				assert.Equal(t, total, tot, "total should not change during the run")
+			}
+			total = tot
+		}),
+	)
+	require.NoError(t, err)
+
+	err = cc.Run("examples/template", "", false)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, dones)
+	for i, d := range dones {
+		assert.Equal(t, i+1, d, "done should increase monotonically")
+	}
+	assert.Equal(t, total, dones[len(dones)-1], "done should reach total")
+	// my_app, README.md, empty.txt, gateway, db.go, auth, config.txt, auth.go, payments, config.txt, payments.go
+	assert.Equal(t, 11, total)
+	assert.Contains(t, paths, "my_app/auth/auth.go")
+}
+
+func TestFanOutOrder(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/info.txt", []byte("info\n"), 0o644))
+
+	model := map[string]any{
+		"features": []any{
+			map[string]any{"name": "payments", "order": 3},
+			map[string]any{"name": "users"},
+			map[string]any{"name": "auth", "order": 1},
+			map[string]any{"name": "billing", "order": 3},
+			map[string]any{"name": "search", "order": 2},
+		},
+	}
+
+	var paths []string
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model,
+		WithFanOutOrder("order"),
+		WithProgress(func(done, total int, path string) {
+			if filepath.Base(path) != "info.txt" {
+				paths = append(paths, filepath.ToSlash(path))
+			}
+		}),
+	)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	// ties keep the array order and elements without the field go last
+	assert.Equal(t, []string{"out/auth", "out/search", "out/payments", "out/billing", "out/users"}, paths)
+}
@@ -0,0 +1,86 @@
+package copycat
+
+import (
+	crand "crypto/rand"
+	"encoding/base64"
+	"math/rand"
+	"strings"
+
+	"github.com/quintans/faults"
+)
+
+const (
+	alphaChars   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	numericChars = "0123456789"
+	// asciiChars are the printable ASCII characters, from space to ~
+	asciiChars = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+)
+
+// WithRandSeed seeds the random source of the random functions
+// (randInt, randAlpha, randAlphaNum, randNumeric, randAscii, randBytes and uuidv4),
+// so that every run with the same seed generates the same output. Without it, the output differs on every run.
+func WithRandSeed(seed int64) Option {
+	return func(cc *CopyCat) {
+		cc.randSeed = &seed
+	}
+}
+
+// resetRand restarts the seeded random source, if any, so that each run produces the same sequence
+func (cc *CopyCat) resetRand() {
+	if cc.randSeed == nil {
+		return
+	}
+	cc.run.rand = rand.New(rand.NewSource(*cc.randSeed))
+}
+
+// intn returns a random number in [0, n) from the seeded source, if any, or the global one
+func (cc *CopyCat) intn(n int) int {
+	if cc.run.rand != nil {
+		return cc.run.rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// randInt returns a random number in [min, max), like sprig's randInt
+func (cc *CopyCat) randInt(min, max int) int {
+	return cc.intn(max-min) + min
+}
+
+// randString returns a random string of length n made of the given chars
+func (cc *CopyCat) randString(n int, chars string) string {
+	var sb strings.Builder
+	for range n {
+		sb.WriteByte(chars[cc.intn(len(chars))])
+	}
+	return sb.String()
+}
+
+// readRand fills b with random bytes from the seeded source, if any, or a cryptographically secure one
+func (cc *CopyCat) readRand(b []byte) error {
+	if cc.run.rand != nil {
+		_, err := cc.run.rand.Read(b)
+		return faults.Wrap(err)
+	}
+	_, err := crand.Read(b)
+	return faults.Wrap(err)
+}
+
+// randBytes returns n random bytes encoded in base64, like sprig's randBytes
+func (cc *CopyCat) randBytes(n int) (string, error) {
+	b := make([]byte, n)
+	if err := cc.readRand(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// uuidv4 returns a random UUID (version 4), like sprig's uuidv4
+func (cc *CopyCat) uuidv4() (string, error) {
+	var u [16]byte
+	if err := cc.readRand(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return formatUUID(u), nil
+}
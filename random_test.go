@@ -0,0 +1,36 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRandSeed(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	template := "secret: {{ randAlphaNum 16 }}\nport: {{ randInt 1024 65535 }}\npin: {{ randNumeric 4 }}\n" +
+		"ascii: {{ randAscii 8 | quote }}\nbytes: {{ randBytes 6 }}\nid: {{ uuidv4 }}\n"
+	err := afero.WriteFile(inFS, "template/config.yaml.tmpl", []byte(template), 0o644)
+	require.NoError(t, err)
+
+	render := func(opts ...Option) string {
+		outFS := afero.NewMemMapFs()
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{}, opts...)
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false))
+
+		data, err := afero.ReadFile(outFS, "out/config.yaml")
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	first := render(WithRandSeed(42))
+	assert.Equal(t, first, render(WithRandSeed(42)))
+	assert.NotEqual(t, first, render(WithRandSeed(7)))
+	assert.Regexp(t, `^secret: [a-zA-Z0-9]{16}\nport: \d+\npin: \d{4}\nascii: ".{8,}"\nbytes: [A-Za-z0-9+/]{8}\nid: [0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\n$`, first)
+
+	// without a seed, every run differs
+	assert.NotEqual(t, render(), render())
+}
@@ -0,0 +1,75 @@
+package copycat
+
+import (
+	"slices"
+	"time"
+)
+
+// Result lists what a run changed in the output, with paths relative to the output directory.
+// A dry run changes nothing, so its result only has the elapsed time.
+type Result struct {
+	// CreatedFiles are the files written, new or overwritten
+	CreatedFiles []string
+	// CreatedDirs are the directories that did not exist before the run
+	CreatedDirs []string
+	// RemovedFiles are the files removed, like the ones that now render to empty content
+	RemovedFiles []string
+	// RemovedDirs are the directories removed because they were left empty
+	RemovedDirs []string
+	// Files has the metrics of the files written, in the order of CreatedFiles
+	Files []FileStats
+	// Elapsed is the duration of the whole run
+	Elapsed time.Duration
+}
+
+// FileStats are the metrics of a file written by a run, to find slow templates
+type FileStats struct {
+	Path string
+	// Bytes is the size of the written content
+	Bytes int64
+	// Duration is the time taken to read, render and write the file
+	Duration time.Duration
+}
+
+// Result returns what the last run changed in the output
+func (cc *CopyCat) Result() Result {
+	return cc.run.result
+}
+
+// recordCreatedFile records a file written by the current run
+// A file removed earlier in the run, when cleaning the output, was overwritten for the caller.
+func (cc *CopyCat) recordCreatedFile(outPath string, bytes int64, started time.Time) {
+	rel := cc.relOutPath(outPath)
+	if i := slices.Index(cc.run.result.RemovedFiles, rel); i >= 0 {
+		cc.run.result.RemovedFiles = slices.Delete(cc.run.result.RemovedFiles, i, i+1)
+	}
+	cc.run.result.CreatedFiles = append(cc.run.result.CreatedFiles, rel)
+	cc.run.result.Files = append(cc.run.result.Files, FileStats{Path: rel, Bytes: bytes, Duration: time.Since(started)})
+}
+
+// recordCreatedDir records a directory created by the current run.
+// A directory removed earlier in the run, when cleaning the output, was never gone for the caller.
+func (cc *CopyCat) recordCreatedDir(outPath string) {
+	rel := cc.relOutPath(outPath)
+	if i := slices.Index(cc.run.result.RemovedDirs, rel); i >= 0 {
+		cc.run.result.RemovedDirs = slices.Delete(cc.run.result.RemovedDirs, i, i+1)
+		return
+	}
+	cc.run.result.CreatedDirs = append(cc.run.result.CreatedDirs, rel)
+}
+
+// recordRemovedFile records a file removed by the current run
+func (cc *CopyCat) recordRemovedFile(outPath string) {
+	cc.run.result.RemovedFiles = append(cc.run.result.RemovedFiles, cc.relOutPath(outPath))
+}
+
+// recordRemovedDir records a directory removed by the current run.
+// A directory created by the same run was never there for the caller, so it is just forgotten.
+func (cc *CopyCat) recordRemovedDir(outPath string) {
+	rel := cc.relOutPath(outPath)
+	if i := slices.Index(cc.run.result.CreatedDirs, rel); i >= 0 {
+		cc.run.result.CreatedDirs = slices.Delete(cc.run.result.CreatedDirs, i, i+1)
+		return
+	}
+	cc.run.result.RemovedDirs = append(cc.run.result.RemovedDirs, rel)
+}
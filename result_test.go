@@ -0,0 +1,59 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResult(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	outFS := afero.NewMemMapFs()
+	err = afero.WriteFile(outFS, "my_app/empty.txt", []byte("pre-existing content"), 0o644)
+	require.NoError(t, err)
+
+	cc, err := NewCopyCat(afero.NewOsFs(), outFS, model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	err = cc.Run("examples/template", "", false)
+	require.NoError(t, err)
+
+	result := cc.Result()
+	assert.Positive(t, result.Elapsed)
+	require.Len(t, result.Files, len(result.CreatedFiles))
+	for i, stats := range result.Files {
+		assert.Equal(t, result.CreatedFiles[i], stats.Path)
+		data, err := afero.ReadFile(outFS, stats.Path)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(data)), stats.Bytes, stats.Path)
+		assert.Positive(t, stats.Duration, stats.Path)
+		assert.LessOrEqual(t, stats.Duration, result.Elapsed, stats.Path)
+	}
+
+	result.Files = nil
+	result.Elapsed = 0
+	assert.Equal(t, Result{
+		CreatedFiles: []string{
+			"my_app/README.md",
+			"my_app/auth/config.txt",
+			"my_app/auth/auth.go",
+			"my_app/payments/config.txt",
+			"my_app/payments/payments.go",
+		},
+		// my_app already existed and the gateway directory was created but removed for being empty
+		CreatedDirs:  []string{"my_app/auth", "my_app/payments"},
+		RemovedFiles: []string{"my_app/empty.txt"},
+	}, result)
+
+	// a dry run changes nothing
+	err = cc.Run("examples/template", "", true)
+	require.NoError(t, err)
+	result = cc.Result()
+	assert.Positive(t, result.Elapsed)
+	result.Elapsed = 0
+	assert.Equal(t, Result{}, result)
+}
@@ -0,0 +1,118 @@
+package copycat
+
+import (
+	"reflect"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// NewCopyCatFromStruct creates a CopyCat from a typed model, a struct or a pointer to one, instead of a map.
+// Path placeholders and templates use the exported field names, like {{ Features.Name }},
+// and walk through nested structs, pointers, slices and maps with string keys.
+// Model values are rendered as templates down to the first struct, so the string fields of nested structs are used as is.
+// A map[string]any model is used as is.
+func NewCopyCatFromStruct(templateFS, outputFS afero.Fs, model any, options ...Option) (*CopyCat, error) {
+	if m, ok := model.(map[string]any); ok {
+		return NewCopyCat(templateFS, outputFS, m, options...)
+	}
+
+	v := indirect(reflect.ValueOf(model))
+	if v.Kind() != reflect.Struct {
+		return nil, faults.Errorf("model must be a struct or a pointer to one, got %T", model)
+	}
+	if !v.CanAddr() {
+		// a copy, so that nested structs become pointers and contexts keep their identity
+		addressable := reflect.New(v.Type()).Elem()
+		addressable.Set(v)
+		v = addressable
+	}
+
+	m := map[string]any{}
+	// including the fields promoted from embedded structs, like objectField resolves them
+	for _, f := range reflect.VisibleFields(v.Type()) {
+		if !f.IsExported() {
+			continue
+		}
+		if field, err := v.FieldByIndexErr(f.Index); err == nil {
+			m[f.Name] = fieldValue(field)
+		}
+	}
+	return NewCopyCat(templateFS, outputFS, m, options...)
+}
+
+// indirect follows pointers and interfaces to the value they hold
+func indirect(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// fieldValue returns the value of a struct field or element, structs as pointers when possible
+// so that the same struct is always the same node
+func fieldValue(v reflect.Value) any {
+	if v.Kind() == reflect.Struct && v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	return v.Interface()
+}
+
+// objectField returns the field of a map or struct model node
+func objectField(obj any, field string) (any, bool) {
+	if m, ok := obj.(map[string]any); ok {
+		val, ok := m[field]
+		return val, ok
+	}
+
+	v := indirect(reflect.ValueOf(obj))
+	switch v.Kind() {
+	case reflect.Struct:
+		sf, ok := v.Type().FieldByName(field)
+		if !ok || !sf.IsExported() {
+			return nil, false
+		}
+		// promoted through a nil embedded pointer, the field is missing
+		fv, err := v.FieldByIndexErr(sf.Index)
+		if err != nil {
+			return nil, false
+		}
+		return fieldValue(fv), true
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, false
+		}
+		val := v.MapIndex(reflect.ValueOf(field).Convert(v.Type().Key()))
+		if !val.IsValid() {
+			return nil, false
+		}
+		return val.Interface(), true
+	}
+	return nil, false
+}
+
+// isObject reports whether the model node is a map or a struct
+func isObject(node any) bool {
+	if _, ok := node.(map[string]any); ok {
+		return true
+	}
+	k := indirect(reflect.ValueOf(node)).Kind()
+	return k == reflect.Struct || k == reflect.Map
+}
+
+// listItems returns the elements of a typed slice or array model node, and whether it is one.
+// Elements that are structs are returned as pointers.
+func listItems(node any) ([]any, bool) {
+	v := indirect(reflect.ValueOf(node))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, false
+	}
+	items := make([]any, v.Len())
+	for i := range items {
+		items[i] = fieldValue(v.Index(i))
+	}
+	return items, true
+}
@@ -0,0 +1,108 @@
+package copycat
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type structKind string
+
+type structFeature struct {
+	Name    string
+	Enabled bool
+}
+
+type structModule struct {
+	Name     string
+	Features []structFeature
+}
+
+type structModel struct {
+	Project  string
+	Kind     structKind
+	Modules  []*structModule
+	Settings map[string]string
+	secret   string
+}
+
+func TestStructModel(t *testing.T) {
+	model := structModel{
+		Project: "shop",
+		Kind:    "service",
+		Modules: []*structModule{
+			{Name: "core", Features: []structFeature{{Name: "auth", Enabled: true}, {Name: "audit"}}},
+			{Name: "sales", Features: []structFeature{{Name: "cart", Enabled: true}, {Name: "orders", Enabled: true}}},
+		},
+		Settings: map[string]string{"format": "yaml"},
+		secret:   "hidden",
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ Project }}/{{ Modules.Name }}/{{ Features.[Enabled].Name }}.go.tmpl", []byte("package {{ .Name }} // {{ (parent).Name }} {{ index1 }}/{{ fanOutLen }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ Project }}/{{ Kind }}.{{ Settings.format }}.tmpl", []byte("{{ (root).Project }} {{ (root).Kind }} {{ .format }}\n"), 0o644))
+
+	for name, m := range map[string]any{"value": model, "pointer": &model} {
+		cc, err := NewCopyCatFromStruct(inFS, afero.NewMemMapFs(), m, WithStrictPaths())
+		require.NoError(t, err, name)
+		files, err := cc.RunToMap("template")
+		require.NoError(t, err, name)
+
+		assert.Equal(t, map[string][]byte{
+			"shop/core/auth.go":    []byte("package auth // core 1/1\n"),
+			"shop/sales/cart.go":   []byte("package cart // sales 1/2\n"),
+			"shop/sales/orders.go": []byte("package orders // sales 2/2\n"),
+			"shop/service.yaml":    []byte("shop service yaml\n"),
+		}, files, name)
+	}
+
+	// unexported fields are not part of the model
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ secret }}.txt", []byte("x"), 0o644))
+	cc, err := NewCopyCatFromStruct(inFS, afero.NewMemMapFs(), model, WithStrictPaths())
+	require.NoError(t, err)
+	_, err = cc.RunToMap("template")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "{{ secret }}")
+
+	_, err = NewCopyCatFromStruct(inFS, afero.NewMemMapFs(), []string{"shop"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "model must be a struct or a pointer to one, got []string")
+}
+
+type structBase struct {
+	ID string
+}
+
+type structItem struct {
+	*structBase
+	Name string
+}
+
+type structEmbeddingModel struct {
+	structBase
+	Items []structItem
+}
+
+func TestStructModelEmbedded(t *testing.T) {
+	model := structEmbeddingModel{
+		structBase: structBase{ID: "root"},
+		Items: []structItem{
+			{structBase: &structBase{ID: "a1"}, Name: "auth"},
+			// nil embedded pointer, so its promoted fields are missing
+			{Name: "cart"},
+		},
+	}
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ ID }}/{{ Items.ID }}.txt", []byte("x"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ ID }}/{{ Items.Name }}.txt", []byte("x"), 0o644))
+
+	cc, err := NewCopyCatFromStruct(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"root/a1.txt", "root/auth.txt", "root/cart.txt"}, slices.Collect(maps.Keys(files)))
+}
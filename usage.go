@@ -0,0 +1,145 @@
+package copycat
+
+import (
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// WithUsageTracking records the model keys accessed by path placeholders, templates and the lookup helper,
+// so that UnusedModelKeys can report the keys that were never used.
+func WithUsageTracking() Option {
+	return func(cc *CopyCat) {
+		cc.trackUsage = true
+	}
+}
+
+// UnusedModelKeys returns the key paths of the model, like "owner.email", that were not accessed since the CopyCat was created.
+// A key is used when accessed directly or through any of its descendants, and when a key is not used, its descendants are not reported.
+// Templates are inspected statically, so that a field access like .name marks every "name" key of the model as used,
+// and keys only accessed dynamically, like with index, are reported.
+// It requires WithUsageTracking, returning nil otherwise.
+func (cc *CopyCat) UnusedModelKeys() []string {
+	if !cc.trackUsage {
+		return nil
+	}
+	var unused []string
+	cc.collectUnused([]map[string]any{cc.model}, nil, &unused)
+	return unused
+}
+
+// collectUnused appends the unused keys of the maps, reached by the key path, to unused,
+// returning whether any of the keys was used
+func (cc *CopyCat) collectUnused(maps []map[string]any, keyPath []string, unused *[]string) bool {
+	keys := map[string]bool{}
+	for _, m := range maps {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	anyUsed := false
+	for _, k := range sorted {
+		path := append(keyPath[:len(keyPath):len(keyPath)], k)
+		if cc.accessed(strings.Join(path, ".")) {
+			anyUsed = true
+			continue
+		}
+
+		var children []map[string]any
+		for _, m := range maps {
+			children = appendMaps(children, m[k])
+		}
+		var nested []string
+		if cc.collectUnused(children, path, &nested) {
+			anyUsed = true
+			*unused = append(*unused, nested...)
+			continue
+		}
+		*unused = append(*unused, strings.Join(path, "."))
+	}
+	return anyUsed
+}
+
+// appendMaps appends the maps in value, looking into arrays, since fan-outs go through them
+func appendMaps(maps []map[string]any, value any) []map[string]any {
+	switch v := value.(type) {
+	case map[string]any:
+		return append(maps, v)
+	case []any:
+		for _, item := range v {
+			maps = appendMaps(maps, item)
+		}
+	}
+	return maps
+}
+
+// accessed reports whether a key path of the model was accessed.
+// Accesses relative to an unknown context match the end of the key path.
+func (cc *CopyCat) accessed(path string) bool {
+	for used := range cc.used {
+		if path == used || strings.HasSuffix(path, "."+used) {
+			return true
+		}
+	}
+	return false
+}
+
+// trackKeys records a key path as accessed
+func (cc *CopyCat) trackKeys(keyPath []string) {
+	if !cc.trackUsage || len(keyPath) == 0 {
+		return
+	}
+	if cc.used == nil {
+		cc.used = map[string]bool{}
+	}
+	for i, key := range keyPath {
+		// the field tested by a filter, like enabled in features.[enabled].name, is used too
+		if field, _, ok := parseFilterKey(key); ok {
+			cc.used[strings.Join(append(withoutFilterKeys(keyPath[:i]), field), ".")] = true
+		}
+	}
+	cc.used[strings.Join(withoutFilterKeys(keyPath), ".")] = true
+}
+
+// trackName records the key paths of the gate and placeholders of a template file or directory name
+func (cc *CopyCat) trackName(name string, frames []contextFrame) {
+	if !cc.trackUsage {
+		return
+	}
+	keys := frames[len(frames)-1].keys
+	if match := dirGate.FindStringSubmatch(name); match != nil {
+		cc.trackKeys(append(keys[:len(keys):len(keys)], splitKeyPath(match[2])...))
+	}
+	for _, match := range placeholderPattern.FindAllStringSubmatch(name, -1) {
+		expr, _ := splitPlaceholder(match[1])
+		expr = strings.TrimPrefix(expr, "=")
+		cc.trackKeys(append(keys[:len(keys):len(keys)], splitKeyPath(expr)...))
+	}
+}
+
+// trackTemplate records the fields accessed by a parsed template
+func (cc *CopyCat) trackTemplate(t *template.Template) {
+	if !cc.trackUsage || t.Tree == nil {
+		return
+	}
+	walkTemplate(t.Tree.Root, func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ChainNode:
+			cc.trackKeys(n.Field)
+		case *parse.FieldNode:
+			cc.trackKeys(n.Ident)
+		case *parse.VariableNode:
+			// $.owner.name and $item.name
+			if len(n.Ident) > 1 {
+				cc.trackKeys(n.Ident[1:])
+			}
+		}
+	})
+}
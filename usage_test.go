@@ -0,0 +1,36 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnusedModelKeys(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/{{ features.name }}/info.txt.tmpl", []byte("{{ .name }} by {{ (root).owner.name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/[[if hasDocs]]docs/README.md", []byte("docs\n"), 0o644))
+
+	model := map[string]any{
+		"hasDocs": false,
+		"extra":   "never used",
+		"owner":   map[string]any{"name": "Acme", "email": "dev@acme.com"},
+		"features": []any{
+			map[string]any{"name": "auth", "enabled": true},
+			map[string]any{"name": "users", "enabled": false},
+		},
+	}
+
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithUsageTracking())
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	assert.Equal(t, []string{"extra", "features.enabled", "owner.email"}, cc.UnusedModelKeys())
+
+	cc, err = NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+	assert.Nil(t, cc.UnusedModelKeys())
+}
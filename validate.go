@@ -0,0 +1,135 @@
+package copycat
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// WithEagerParse parses every template file under the given directories when the CopyCat is created,
+// failing with all the parse errors found instead of stopping mid-run at the first malformed template.
+// Without directories, the whole template filesystem is parsed, which suits filesystems rooted at the template tree,
+// like the ones of NewFromDir and NewCopyCatFromFS. Templates are still executed only when run.
+func WithEagerParse(templatePaths ...string) Option {
+	return func(cc *CopyCat) {
+		cc.eagerParse = templatePaths
+		if len(templatePaths) == 0 {
+			cc.eagerParse = []string{"."}
+		}
+	}
+}
+
+// parseTrees parses the template files under the directories, keeping them for the runs,
+// and returns the parse errors of all of them
+func (cc *CopyCat) parseTrees(templatePaths []string) error {
+	var errs []error
+	for _, templatePath := range templatePaths {
+		err := afero.Walk(cc.templateFS, templatePath, func(path string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return faults.Wrap(err)
+			}
+			if info.IsDir() || info.Name() == keepMarker || path == filepath.Join(templatePath, templateConfigFile) {
+				return nil
+			}
+			if cc.renderOnlySuffixed && !cc.parseFileName(info.Name()).isTemplate {
+				return nil
+			}
+
+			data, err := cc.readTemplate(path)
+			if err != nil {
+				return faults.Wrap(err)
+			}
+			// parsed as it is rendered, so that runs reuse it
+			source := string(data)
+			if cc.collapseBlankLines {
+				source = markActionLines(source)
+			}
+			if _, err := cc.parse(source); err != nil {
+				errs = append(errs, &TemplateParseError{Path: path, Err: err})
+			}
+			return nil
+		})
+		if err != nil {
+			return faults.Wrap(err)
+		}
+	}
+	if len(errs) > 0 {
+		return faults.Wrap(errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate renders every path and file of the template tree against the model, like a dry run,
+// without writing or reporting anything. The template config and the name transform apply as they do to a run,
+// so only the entries a run would generate are validated.
+// Unlike a dry run, it does not stop at the first failure, returning all the errors found.
+func (cc *CopyCat) Validate(templatePath string) error {
+	cfg, err := cc.loadTemplateConfig(templatePath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	cc.run = runState{templateRoot: templatePath, outRoot: ".", config: cfg}
+
+	var errs []error
+	if err := cc.validateDir(templatePath, cc.run.outRoot, []contextFrame{{ctx: cc.model}}, &errs); err != nil {
+		return faults.Wrap(err)
+	}
+	if len(errs) > 0 {
+		return faults.Wrap(errors.Join(errs...))
+	}
+	return nil
+}
+
+// validateDir collects the rendering errors of the template directory into errs.
+// Only failures to read the template tree are returned.
+func (cc *CopyCat) validateDir(currentTemplatePath string, currentOutPath string, frames []contextFrame, errs *[]error) error {
+	entries, err := cc.readTemplateDir(currentTemplatePath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+
+	for _, entry := range entries {
+		templateFile := filepath.Join(currentTemplatePath, entry.Name())
+		items, err := cc.listEntry(currentTemplatePath, currentOutPath, entry, frames)
+		if err != nil {
+			*errs = append(*errs, faults.Wrapf(err, "expanding %s", templateFile))
+			continue
+		}
+
+		for _, item := range items {
+			if item.isDir {
+				if err := cc.validateDir(templateFile, item.outPath, item.frames, errs); err != nil {
+					return faults.Wrap(err)
+				}
+				continue
+			}
+
+			// a failing transform was already reported by listEntry
+			if _, ok, err := cc.transformName(templateFile, cc.parseFileName(item.outPath).path); err != nil || !ok {
+				continue
+			}
+			if cc.renderOnlySuffixed && !cc.parseFileName(entry.Name()).isTemplate {
+				continue
+			}
+
+			data, err := cc.readTemplate(templateFile)
+			if err != nil {
+				return faults.Wrap(err)
+			}
+			scope := renderScope{
+				templateDir: currentTemplatePath,
+				parent:      parentContext(item.frames),
+				frame:       item.frames[len(item.frames)-1],
+				dirFrame:    frames[len(frames)-1],
+				file:        templateFile,
+			}
+			if _, err := cc.renderScoped(string(data), item.ctx, scope); err != nil && !errors.Is(err, errSkipFile) {
+				*errs = append(*errs, faults.Wrapf(err, "rendering %s", templateFile))
+			}
+		}
+	}
+	return nil
+}
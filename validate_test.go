@@ -0,0 +1,113 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+
+	err := afero.WriteFile(inFS, "template/a.txt", []byte("{{ .porjectName }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/b.txt", []byte("{{ .projectName }}"), 0o644)
+	require.NoError(t, err)
+	err = afero.WriteFile(inFS, "template/{{ features.name }}/c.txt", []byte("{{ if .name }}"), 0o644)
+	require.NoError(t, err)
+
+	model := map[string]any{
+		"projectName": "App",
+		"features": []any{
+			map[string]any{"name": "auth"},
+		},
+	}
+
+	outFS := afero.NewMemMapFs()
+	cc, err := NewCopyCat(inFS, outFS, model)
+	require.NoError(t, err)
+
+	// a dry run stops at the first failure
+	err = cc.Run("template", "out", true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "porjectName")
+	assert.NotContains(t, err.Error(), "c.txt")
+
+	err = cc.Validate("template")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rendering template/a.txt")
+	assert.Contains(t, err.Error(), "porjectName")
+	assert.Contains(t, err.Error(), "rendering template/{{ features.name }}/c.txt")
+	assert.NotContains(t, err.Error(), "b.txt")
+
+	files, err := afero.ReadDir(outFS, "")
+	require.NoError(t, err)
+	assert.Empty(t, files, "validate should not write anything")
+}
+
+func TestValidateSkipsEntriesNotGenerated(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/.copycat.yaml", []byte("exclude:\n  - legacy\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/legacy/old.txt", []byte("{{ .missing }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/draft.txt", []byte("{{ if .name }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("# {{ .nmae }}\n"), 0o644))
+	model := map[string]any{"name": "app"}
+
+	skipDrafts := func(path string) string {
+		if path == "draft.txt" {
+			return ""
+		}
+		return path
+	}
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithNameTransform(skipDrafts))
+	require.NoError(t, err)
+
+	// only the entries a run generates are validated
+	err = cc.Validate("template")
+	assert.ErrorContains(t, err, "rendering template/README.md")
+	assert.NotContains(t, err.Error(), "old.txt")
+	assert.NotContains(t, err.Error(), "draft.txt")
+}
+
+func TestValidateExamples(t *testing.T) {
+	model, err := LoadModel("examples/model.yaml")
+	require.NoError(t, err, "failed to load model")
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewMemMapFs(), model, WithCustomFuncs(customFuncs))
+	require.NoError(t, err)
+
+	assert.NoError(t, cc.Validate("examples/template"))
+}
+
+func TestEagerParse(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/README.md", []byte("# {{ .name }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/a.txt", []byte("{{ if .name }}"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/deep/{{ features.name }}/b.txt", []byte("{{ .name "), 0o644))
+	model := map[string]any{"name": "app", "features": []any{}}
+
+	// without eager parsing, creating does not look at the templates
+	_, err := NewCopyCat(inFS, afero.NewMemMapFs(), model)
+	require.NoError(t, err)
+
+	_, err = NewCopyCat(inFS, afero.NewMemMapFs(), model, WithEagerParse("template"))
+	assert.ErrorIs(t, err, ErrTemplateParse)
+	assert.ErrorContains(t, err, "template/a.txt")
+	// never rendered, since features is empty, but still reported
+	assert.ErrorContains(t, err, "template/deep/{{ features.name }}/b.txt")
+	assert.NotContains(t, err.Error(), "README.md")
+
+	// the whole filesystem by default
+	_, err = NewCopyCat(afero.NewBasePathFs(inFS, "template"), afero.NewMemMapFs(), model, WithEagerParse())
+	assert.ErrorContains(t, err, "a.txt")
+
+	require.NoError(t, inFS.Remove("template/a.txt"))
+	require.NoError(t, inFS.Remove("template/deep/{{ features.name }}/b.txt"))
+	cc, err := NewCopyCat(inFS, afero.NewMemMapFs(), model, WithEagerParse("template"))
+	require.NoError(t, err)
+	files, err := cc.RunToMap("template")
+	require.NoError(t, err)
+	assert.Equal(t, "# app\n", string(files["README.md"]))
+}
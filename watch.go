@@ -0,0 +1,106 @@
+package copycat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// ErrWatchUnsupported is returned when watching a template filesystem that is not the OS filesystem
+var ErrWatchUnsupported = errors.New("watch is only supported for templates in the OS filesystem")
+
+// watchDebounce is how long a watch waits for the template changes to settle before regenerating
+const watchDebounce = 200 * time.Millisecond
+
+// Watch runs the template tree and then watches it, running it again whenever its files change,
+// until the process ends. Bursts of changes, like an editor saving several files, trigger a single run.
+// A failed run is printed to stderr and watching goes on, so that mistakes can be fixed while developing templates.
+// It is only supported when the template filesystem is the OS one, returning ErrWatchUnsupported otherwise.
+func (cc *CopyCat) Watch(templatePath, outPath string) error {
+	return cc.WatchContext(context.Background(), templatePath, outPath)
+}
+
+// WatchContext is like Watch, but stops watching when the context is done.
+func (cc *CopyCat) WatchContext(ctx context.Context, templatePath, outPath string) error {
+	if _, ok := cc.templateFS.(*afero.OsFs); !ok {
+		return faults.Wrap(ErrWatchUnsupported)
+	}
+	// generating inside the watched tree would trigger runs forever, even when forced
+	nestedOut, err := cc.checkOverlap(templatePath, outPath)
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	if nestedOut != "" {
+		return faults.Wrap(&OutputOverlapError{TemplatePath: templatePath, OutPath: outPath})
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return faults.Wrap(err)
+	}
+	defer watcher.Close()
+
+	if err := watchTree(watcher, templatePath); err != nil {
+		return faults.Wrap(err)
+	}
+
+	cc.rerun(templatePath, outPath)
+
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Has(fsnotify.Create) {
+				// new directories are watched too
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						return faults.Wrap(err)
+					}
+				}
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			return faults.Wrap(err)
+		case <-timer.C:
+			cc.rerun(templatePath, outPath)
+		}
+	}
+}
+
+// rerun runs the template tree, printing the failure instead of returning it
+func (cc *CopyCat) rerun(templatePath, outPath string) {
+	if err := cc.Run(templatePath, outPath, false); err != nil {
+		fmt.Fprintf(os.Stderr, "regeneration failed: %+v\n", err)
+		return
+	}
+	if !cc.quiet {
+		fmt.Fprintf(cc.out(), "regenerated %s\n", outPath)
+	}
+}
+
+// watchTree adds a directory and all its subdirectories to the watcher, since fsnotify does not watch recursively
+func watchTree(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		return watcher.Add(path)
+	})
+}
@@ -0,0 +1,63 @@
+package copycat
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	templateDir := t.TempDir()
+	outDir := t.TempDir()
+	template := filepath.Join(templateDir, "hello.txt.tmpl")
+	require.NoError(t, os.WriteFile(template, []byte("hello {{ .name }}\n"), 0o644))
+
+	cc, err := NewCopyCat(afero.NewOsFs(), afero.NewOsFs(), map[string]any{"name": "world"}, WithQuiet())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- cc.WatchContext(ctx, templateDir, outDir)
+	}()
+
+	output := func() string {
+		data, _ := os.ReadFile(filepath.Join(outDir, "hello.txt"))
+		return string(data)
+	}
+	require.Eventually(t, func() bool { return output() == "hello world\n" }, 5*time.Second, 20*time.Millisecond)
+
+	// changing a template regenerates the output
+	require.NoError(t, os.WriteFile(template, []byte("goodbye {{ .name }}\n"), 0o644))
+	require.Eventually(t, func() bool { return output() == "goodbye world\n" }, 5*time.Second, 20*time.Millisecond)
+
+	// so does adding a file to a new directory
+	require.NoError(t, os.Mkdir(filepath.Join(templateDir, "docs"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(templateDir, "docs", "README.md"), []byte("# {{ .name }}\n"), 0o644))
+	require.Eventually(t, func() bool {
+		data, err := os.ReadFile(filepath.Join(outDir, "docs", "README.md"))
+		return err == nil && string(data) == "# world\n"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop")
+	}
+}
+
+func TestWatchUnsupported(t *testing.T) {
+	cc, err := NewCopyCat(afero.NewMemMapFs(), afero.NewMemMapFs(), map[string]any{})
+	require.NoError(t, err)
+
+	err = cc.Watch("template", "out")
+	assert.ErrorIs(t, err, ErrWatchUnsupported)
+}
@@ -0,0 +1,75 @@
+package copycat
+
+import (
+	"os"
+
+	"github.com/quintans/faults"
+	"github.com/spf13/afero"
+)
+
+// WriteMode is how generated files are written over existing output files
+type WriteMode string
+
+const (
+	// WriteModeTruncate replaces the content of existing files. This is the default.
+	WriteModeTruncate WriteMode = "truncate"
+	// WriteModeAppend adds the generated content at the end of existing files, after the append separator
+	WriteModeAppend WriteMode = "append"
+)
+
+// WithWriteMode sets how generated files are written over existing output files. Defaults to WriteModeTruncate.
+// When appending, merge regions are not applied and files that render to empty are left untouched.
+func WithWriteMode(mode WriteMode) Option {
+	return func(cc *CopyCat) {
+		cc.writeMode = mode
+	}
+}
+
+// WithAppendSeparator sets what is written between the existing content of a file and the appended one,
+// e.g. "\n---\n". It is not written to files that do not exist or are empty. Defaults to nothing.
+func WithAppendSeparator(separator string) Option {
+	return func(cc *CopyCat) {
+		cc.appendSeparator = separator
+	}
+}
+
+// appending reports whether generated content is appended to existing files. Forced runs always overwrite.
+func (cc *CopyCat) appending() bool {
+	return cc.writeMode == WriteModeAppend && !cc.force
+}
+
+// openOutput opens an output file for writing, according to the write mode.
+// Existing files that are overwritten get the mode too, since it only applies to the files being created.
+// When appending to a file that has content, the append separator is written first.
+func (cc *CopyCat) openOutput(outPath string, mode os.FileMode) (afero.File, error) {
+	if !cc.appending() {
+		f, err := cc.outputFS.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+		if err != nil {
+			return nil, faults.Wrap(err)
+		}
+		if err := cc.outputFS.Chmod(outPath, mode); err != nil {
+			_ = f.Close()
+			return nil, faults.Wrap(err)
+		}
+		return f, nil
+	}
+
+	var size int64
+	if info, err := cc.outputFS.Stat(outPath); err == nil {
+		size = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, faults.Wrap(err)
+	}
+
+	f, err := cc.outputFS.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, mode)
+	if err != nil {
+		return nil, faults.Wrap(err)
+	}
+	if size > 0 && cc.appendSeparator != "" {
+		if _, err := f.WriteString(cc.appendSeparator); err != nil {
+			_ = f.Close()
+			return nil, faults.Wrap(err)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,42 @@
+package copycat
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteModeAppend(t *testing.T) {
+	inFS := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(inFS, "template/changelog.md.tmpl", []byte("## {{ .version }}\n"), 0o644))
+	require.NoError(t, afero.WriteFile(inFS, "template/notes.txt", []byte("verbatim\n"), 0o644))
+
+	outFS := afero.NewMemMapFs()
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		cc, err := NewCopyCat(inFS, outFS, map[string]any{"version": version},
+			WithWriteMode(WriteModeAppend),
+			WithAppendSeparator("\n"),
+		)
+		require.NoError(t, err)
+		require.NoError(t, cc.Run("template", "out", false))
+	}
+
+	data, err := afero.ReadFile(outFS, "out/changelog.md")
+	require.NoError(t, err)
+	assert.Equal(t, "## 1.0.0\n\n## 1.1.0\n", string(data))
+
+	data, err = afero.ReadFile(outFS, "out/notes.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "verbatim\n\nverbatim\n", string(data))
+
+	// truncating, the default, replaces both renders
+	cc, err := NewCopyCat(inFS, outFS, map[string]any{"version": "2.0.0"})
+	require.NoError(t, err)
+	require.NoError(t, cc.Run("template", "out", false))
+
+	data, err = afero.ReadFile(outFS, "out/changelog.md")
+	require.NoError(t, err)
+	assert.Equal(t, "## 2.0.0\n", string(data))
+}